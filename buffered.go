@@ -0,0 +1,184 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import "sync"
+
+// Buffered keeps all Debug entries of a unit of work, like a request or a
+// job, in memory. Info entries get written immediately. If an Info entry
+// contains an error, see Err, or Flush gets called, the buffered Debug entries
+// get written in order and all further Debug entries bypass the buffer.
+// Otherwise Discard drops them at the end of the unit of work. This provides
+// full debug context for failed units without paying for the debug output of
+// the successful ones. The fields get evaluated when an entry gets buffered,
+// see Capture, so StringFn and Marshaler fields report the state at the time
+// of the Debug call and not of the flush.
+//
+// Loggers created by With share the buffer with their parent. Buffered is
+// safe for concurrent use.
+type Buffered struct {
+	info  Logger
+	debug Logger
+	s     *bufferedState
+}
+
+type bufferedState struct {
+	mu         sync.Mutex
+	maxEntries int
+	trigger    func(msg string, fields Fields) bool // nil checks for errors
+	entries    []bufferedEntry
+	dropped    int
+	flushed    bool
+}
+
+type bufferedEntry struct {
+	l      Logger
+	msg    string
+	fields Fields
+}
+
+// BufferedOption can be used as an argument in NewBuffered to configure the
+// buffer.
+type BufferedOption func(*bufferedState)
+
+// WithBufferedMaxEntries limits the amount of buffered Debug entries. If the
+// buffer is full, the oldest entry gets dropped. The amount of dropped entries
+// gets logged with the flush. Zero means unlimited, which is the default.
+func WithBufferedMaxEntries(n int) BufferedOption {
+	return func(s *bufferedState) {
+		s.maxEntries = n
+	}
+}
+
+// WithBufferedTrigger sets the function which decides whether an Info entry
+// flushes the buffer. It receives the captured fields, see Capture. Defaults
+// to a check for an error as reported by Capture, for example a field created
+// by Err with a non-nil error.
+func WithBufferedTrigger(fn func(msg string, fields Fields) bool) BufferedOption {
+	return func(s *bufferedState) {
+		s.trigger = fn
+	}
+}
+
+// NewBuffered creates a new buffering Logger. Info entries get written to
+// info, flushed Debug entries to debug. The debug Logger must be configured
+// with Debug level, otherwise the flushed entries get lost. If debug is nil,
+// info gets used for both.
+func NewBuffered(info, debug Logger, opts ...BufferedOption) *Buffered {
+	if debug == nil {
+		debug = info
+	}
+	s := new(bufferedState)
+	for _, o := range opts {
+		o(s)
+	}
+	return &Buffered{
+		info:  info,
+		debug: debug,
+		s:     s,
+	}
+}
+
+// With returns a new Logger that has this logger's context plus the given
+// Fields. The new Logger shares the buffer.
+func (b *Buffered) With(fields ...Field) Logger {
+	return &Buffered{
+		info:  b.info.With(fields...),
+		debug: b.debug.With(fields...),
+		s:     b.s,
+	}
+}
+
+// Debug buffers the entry or writes it if the buffer has already been
+// flushed. Nothing gets buffered if the debug Logger has Debug level
+// disabled.
+func (b *Buffered) Debug(msg string, fields ...Field) {
+	if !b.debug.IsDebug() {
+		return
+	}
+	// Evaluate the fields outside of the lock.
+	captured, _ := Capture(fields...)
+	s := b.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushed {
+		b.debug.Debug(msg, captured...)
+		return
+	}
+	if s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		copy(s.entries, s.entries[1:])
+		s.entries = s.entries[:len(s.entries)-1]
+		s.dropped++
+	}
+	s.entries = append(s.entries, bufferedEntry{l: b.debug, msg: msg, fields: captured})
+}
+
+// Info writes the entry. If the trigger matches, the buffer gets flushed
+// before.
+func (b *Buffered) Info(msg string, fields ...Field) {
+	captured, hasErr := Capture(fields...)
+	if b.s.trigger != nil {
+		hasErr = b.s.trigger(msg, captured)
+	}
+	if hasErr {
+		b.Flush()
+	}
+	b.info.Info(msg, captured...)
+}
+
+// Flush writes all buffered Debug entries in order. All further Debug entries
+// get written immediately.
+func (b *Buffered) Flush() {
+	s := b.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped > 0 {
+		b.debug.Debug("[log] Buffered dropped entries", Int("dropped", s.dropped))
+		s.dropped = 0
+	}
+	for i, e := range s.entries {
+		e.l.Debug(e.msg, e.fields...)
+		s.entries[i] = bufferedEntry{}
+	}
+	s.entries = nil
+	s.flushed = true
+}
+
+// Discard drops all buffered Debug entries.
+func (b *Buffered) Discard() {
+	s := b.s
+	s.mu.Lock()
+	s.entries = nil
+	s.dropped = 0
+	s.mu.Unlock()
+}
+
+// Flushed reports whether the buffer has been flushed.
+func (b *Buffered) Flushed() bool {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	return b.s.flushed
+}
+
+// IsDebug returns true if Debug level is enabled in the debug Logger. It does
+// not depend on the Info logger because Debug entries get buffered.
+func (b *Buffered) IsDebug() bool {
+	return b.debug.IsDebug()
+}
+
+// IsInfo returns true if Info level is enabled in the info Logger.
+func (b *Buffered) IsInfo() bool {
+	return b.info.IsInfo()
+}
@@ -0,0 +1,146 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ log.Logger = (*log.Buffered)(nil)
+
+func newBuffered(opts ...log.BufferedOption) (*bytes.Buffer, *log.Buffered) {
+	buf := new(bytes.Buffer)
+	info := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+	debug := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+	return buf, log.NewBuffered(info, debug, opts...)
+}
+
+func TestBuffered_Discard(t *testing.T) {
+	buf, b := newBuffered()
+	assert.True(t, b.IsDebug())
+	assert.True(t, b.IsInfo())
+
+	b.Debug("d1")
+	b.With(log.Int("n", 2)).Debug("d2")
+	b.Info("i1", log.Err(nil))
+	b.Discard()
+	assert.False(t, b.Flushed())
+	assert.Exactly(t, "INFO i1 error: \"<nil>\"\n", buf.String())
+}
+
+func TestBuffered_FlushOnError(t *testing.T) {
+	buf, b := newBuffered()
+
+	b.Debug("d1")
+	b.With(log.Int("n", 2)).Debug("d2")
+	b.Info("i1")
+	b.Info("failed", log.Fields{log.Err(errors.New("boom"))})
+	b.Debug("d3")
+	b.Discard()
+
+	assert.True(t, b.Flushed())
+	assert.Exactly(t, "INFO i1\n"+
+		"DEBUG d1\n"+
+		"DEBUG d2 n: 2\n"+
+		"INFO failed error: \"boom\"\n"+
+		"DEBUG d3\n", buf.String())
+}
+
+func TestBuffered_Options(t *testing.T) {
+	buf, b := newBuffered(
+		log.WithBufferedMaxEntries(2),
+		log.WithBufferedTrigger(func(msg string, _ log.Fields) bool { return msg == "alarm" }),
+	)
+	b.Debug("d1")
+	b.Debug("d2")
+	b.Debug("d3")
+	b.Info("ok", log.Err(errors.New("ignored")))
+	assert.Exactly(t, "INFO ok error: \"ignored\"\n", buf.String())
+
+	b.Info("alarm")
+	assert.Exactly(t, "INFO ok error: \"ignored\"\n"+
+		"DEBUG [log] Buffered dropped entries dropped: 1\n"+
+		"DEBUG d2\n"+
+		"DEBUG d3\n"+
+		"INFO alarm\n", buf.String())
+}
+
+func TestBuffered_EvaluatesWhenBuffered(t *testing.T) {
+	buf, b := newBuffered()
+	state := "loading"
+	var calls int
+	b.Debug("d1", log.StringFn("state", func(add log.AddStringFn) error {
+		calls++
+		add("state", state)
+		return nil
+	}))
+	state = "done"
+	assert.Exactly(t, 1, calls)
+
+	b.Info("failed", log.Marshal("m", errMarshaler{calls: &calls}))
+	assert.Exactly(t, 2, calls, "The trigger must not evaluate the fields again")
+	assert.Exactly(t, "DEBUG d1 state: \"loading\"\n"+
+		"INFO failed error: marshal failed\n", buf.String())
+}
+
+type errMarshaler struct {
+	calls *int
+}
+
+func (em errMarshaler) MarshalLog(log.KeyValuer) error {
+	*em.calls++
+	return errors.New("marshal failed")
+}
+
+func TestBuffered_IsDebug(t *testing.T) {
+	buf := new(bytes.Buffer)
+	info := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+	b := log.NewBuffered(info, nil)
+	assert.False(t, b.IsDebug(), "IsDebug must follow the debug Logger")
+	b.Debug("d1")
+	b.Flush()
+	b.Info("i1")
+	assert.Exactly(t, "INFO i1\n", buf.String())
+}
+
+func TestBuffered_Concurrent(t *testing.T) {
+	var buf log.MutexBuffer
+	lg := logw.NewLog(logw.WithWriter(&buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+	b := log.NewBuffered(lg, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := b.With(log.Int("g", i))
+			l.Debug("d")
+			if i == 5 {
+				b.Flush()
+			}
+			l.Debug("d")
+		}(i)
+	}
+	wg.Wait()
+	b.Flush()
+	assert.Exactly(t, 20, bytes.Count(buf.Bytes(), []byte("DEBUG d g: ")))
+}
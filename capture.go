@@ -0,0 +1,166 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+
+	"github.com/corestoreio/errors"
+)
+
+// Capture evaluates the fields once and returns fields which replay the
+// captured values without evaluating StringFn, Stringer or Marshaler fields
+// again. Use it to buffer entries or to inspect fields before logging them.
+// hasErr reports whether the fields contain an error: a field with the key
+// KeyNameError and a value other than "<nil>", as created by Err, or a
+// StringFn or Marshaler field which returned an error. Like Fields.AddTo,
+// Capture stops at the first failing field and the captured fields return its
+// error from AddTo.
+func Capture(fields ...Field) (captured Fields, hasErr bool) {
+	if len(fields) == 0 {
+		return nil, false
+	}
+	c := &capturer{fields: make(Fields, 0, len(fields))}
+	for _, f := range fields {
+		if err := f.AddTo(c); err != nil {
+			c.fields = append(c.fields, capturedErr{err: err})
+			c.hasErr = true
+			break
+		}
+	}
+	return c.fields, c.hasErr
+}
+
+// capturer implements KeyValuer and converts the added values into fields.
+type capturer struct {
+	fields Fields
+	hasErr bool
+}
+
+func (c *capturer) AddBool(k string, v bool)          { c.fields = append(c.fields, Bool(k, v)) }
+func (c *capturer) AddFloat64(k string, v float64)    { c.fields = append(c.fields, Float64(k, v)) }
+func (c *capturer) AddInt(k string, v int)            { c.fields = append(c.fields, Int(k, v)) }
+func (c *capturer) AddInt64(k string, v int64)        { c.fields = append(c.fields, Int64(k, v)) }
+func (c *capturer) AddUint64(k string, v uint64)      { c.fields = append(c.fields, Uint64(k, v)) }
+func (c *capturer) AddObject(k string, v interface{}) { c.fields = append(c.fields, Object(k, v)) }
+
+func (c *capturer) AddString(k string, v string) {
+	if k == KeyNameError && v != "<nil>" {
+		c.hasErr = true
+	}
+	c.fields = append(c.fields, String(k, v))
+}
+
+func (c *capturer) AddMarshaler(k string, v Marshaler) error {
+	nested := &capturer{}
+	err := v.MarshalLog(nested)
+	c.hasErr = c.hasErr || nested.hasErr || err != nil
+	c.fields = append(c.fields, Marshal(k, capturedMarshaler{fields: nested.fields, err: err}))
+	return nil
+}
+
+// Nest returns the error of f to the Marshaler, which decides about it, as
+// the other KeyValuers do.
+func (c *capturer) Nest(k string, f func(KeyValuer) error) error {
+	nested := &capturer{}
+	err := f(nested)
+	c.hasErr = c.hasErr || nested.hasErr
+	c.fields = append(c.fields, capturedNest{key: k, fields: nested.fields})
+	return errors.WithStack(err)
+}
+
+// capturedMarshaler replays the values and the error of a Marshaler.
+type capturedMarshaler struct {
+	fields Fields
+	err    error
+}
+
+func (cm capturedMarshaler) MarshalLog(kv KeyValuer) error {
+	if err := cm.fields.AddTo(kv); err != nil {
+		return errors.WithStack(err)
+	}
+	return cm.err
+}
+
+// capturedErr replays the error of a failing field.
+type capturedErr struct {
+	err error
+}
+
+func (ce capturedErr) make() field {
+	return field{key: KeyNameError, fieldType: typeString, string: fmt.Sprintf("%+v", ce.err)}
+}
+
+func (ce capturedErr) AddTo(KeyValuer) error {
+	return ce.err
+}
+
+// capturedNest replays a call to KeyValuer.Nest.
+type capturedNest struct {
+	key    string
+	fields Fields
+}
+
+func (cn capturedNest) make() field {
+	return field{key: cn.key, fieldType: typeFields, obj: cn.fields}
+}
+
+func (cn capturedNest) AddTo(kv KeyValuer) error {
+	return kv.Nest(cn.key, cn.fields.AddTo)
+}
+
+// CapturedValue returns the key and the value of a field returned by Capture.
+// The value has the type of the KeyValuer function which added it: bool,
+// float64, int, int64, uint64, string or the object of AddObject. Marshalers
+// and nested fields return their captured Fields, an error of a Marshaler gets
+// appended to them. The error which stopped Capture gets returned as string
+// with the key KeyNameError. ok is false if the field has not been created by
+// Capture.
+func CapturedValue(f Field) (key string, value interface{}, ok bool) {
+	switch cf := f.(type) {
+	case capturedNest:
+		return cf.key, cf.fields, true
+	case capturedErr:
+		cef := cf.make()
+		return cef.key, cef.string, true
+	case field:
+		switch cf.fieldType {
+		case typeBool:
+			return cf.key, cf.int64 == 1, true
+		case typeFloat64:
+			return cf.key, cf.float64, true
+		case typeInt:
+			return cf.key, int(cf.int64), true
+		case typeInt64:
+			return cf.key, cf.int64, true
+		case typeUint64:
+			return cf.key, cf.uint64, true
+		case typeString:
+			return cf.key, cf.string, true
+		case typeObject:
+			return cf.key, cf.obj, true
+		case typeMarshaler:
+			cm, ok := cf.obj.(capturedMarshaler)
+			if !ok {
+				return "", nil, false
+			}
+			if cm.err == nil {
+				return cf.key, cm.fields, true
+			}
+			return cf.key, append(cm.fields[:len(cm.fields):len(cm.fields)], capturedErr{err: cm.err}), true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,123 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+type nestMarshaler struct {
+	calls *int
+	err   error
+}
+
+func (nm nestMarshaler) MarshalLog(kv log.KeyValuer) error {
+	*nm.calls++
+	kv.AddInt("calls", *nm.calls)
+	if err := kv.Nest("nest", func(kv log.KeyValuer) error {
+		kv.AddBool("b", true)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nm.err
+}
+
+func TestCapture(t *testing.T) {
+	var fnCalls, mCalls int
+	fields := log.Fields{
+		log.String("s", "x"),
+		log.StringFn("fn", func(add log.AddStringFn) error {
+			fnCalls++
+			add("fn", strconv.Itoa(fnCalls))
+			return nil
+		}),
+		log.Marshal("m", nestMarshaler{calls: &mCalls}),
+		log.Err(nil),
+	}
+	captured, hasErr := log.Capture(fields...)
+	assert.False(t, hasErr)
+	assert.Exactly(t, 1, fnCalls)
+	assert.Exactly(t, 1, mCalls)
+
+	const want = ` s: "x" fn: "1" calls: 1 nest:  b: true error: "<nil>"`
+	assert.Exactly(t, "msg"+want+"\n", captured.ToString("msg"))
+	assert.Exactly(t, want, captured.Encode())
+	assert.Exactly(t, 1, fnCalls, "Replaying must not evaluate the StringFn again")
+	assert.Exactly(t, 1, mCalls, "Replaying must not evaluate the Marshaler again")
+
+	captured, hasErr = log.Capture()
+	assert.Empty(t, captured)
+	assert.False(t, hasErr)
+}
+
+func TestCapture_Errors(t *testing.T) {
+	var calls int
+	tests := []struct {
+		field log.Field
+		want  string
+	}{
+		{log.Err(errors.New("boom")), ` error: "boom"`},
+		{log.Fields{log.Int("a", 1), log.Err(errors.New("nested"))}, ` error: "nested"`},
+		{log.Marshal("m", nestMarshaler{calls: &calls, err: errors.New("marshal failed")}), ` error: marshal failed`},
+		{log.StringFn("fn", func(log.AddStringFn) error { return errors.New("fn failed") }), ` error: fn failed`},
+	}
+	for _, test := range tests {
+		direct := log.Fields{test.field}.Encode()
+		captured, hasErr := log.Capture(test.field)
+		assert.True(t, hasErr, "%s", direct)
+		assert.Contains(t, direct, test.want)
+		assert.Contains(t, captured.Encode(), test.want)
+	}
+}
+
+func TestCapturedValue(t *testing.T) {
+	var calls int
+	captured, _ := log.Capture(
+		log.Bool("b", true), log.Float64("f", 1.5), log.Int("i", 2), log.Int64("i64", 3),
+		log.Uint64("u64", 4), log.String("s", "x"), log.Object("o", []int{5}),
+		log.Marshal("m", nestMarshaler{calls: &calls, err: errors.New("marshal failed")}),
+		log.StringFn("fn", func(log.AddStringFn) error { return errors.New("fn failed") }),
+	)
+	var keys []string
+	var values []interface{}
+	for _, f := range captured {
+		key, value, ok := log.CapturedValue(f)
+		assert.True(t, ok, "%#v", f)
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	assert.Exactly(t, []string{"b", "f", "i", "i64", "u64", "s", "o", "m", "error"}, keys)
+	assert.Exactly(t, []interface{}{true, 1.5, 2, int64(3), uint64(4), "x", []int{5}}, values[:7])
+	assert.True(t, strings.HasPrefix(values[8].(string), "fn failed\n"), "%s", values[8])
+
+	nested := values[7].(log.Fields)
+	assert.Len(t, nested, 3)
+	key, value, _ := log.CapturedValue(nested[1])
+	assert.Exactly(t, "nest", key)
+	assert.Exactly(t, ` b: true`, value.(log.Fields).Encode())
+	key, value, _ = log.CapturedValue(nested[2])
+	assert.Exactly(t, log.KeyNameError, key)
+	assert.True(t, strings.HasPrefix(value.(string), "marshal failed"), "%s", value)
+
+	_, _, ok := log.CapturedValue(log.StringFn("fn", nil))
+	assert.False(t, ok, "Only captured fields have a value")
+}
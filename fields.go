@@ -35,6 +35,7 @@
 package log
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
 	"time"
@@ -146,19 +147,44 @@ func (fs Fields) MarshalLog(kv KeyValuer) error {
 // ToString transforms multiple fields into a single string using the
 // format of the type KVStringify.
 func (fs Fields) ToString(msg string) string {
+	return fs.ToStringEncoded(msg, "")
+}
+
+// ToStringEncoded works like ToString but writes the already encoded fields,
+// see Encode, between the message and fs. Loggers use it to encode the fields
+// of With only once.
+func (fs Fields) ToStringEncoded(msg, encoded string) string {
 	buf := bufferpool.Get()
 	defer bufferpool.Put(buf)
-	wt := WriteTypes{W: buf}
 
 	_, _ = buf.WriteString(msg)
-	if err := fs.AddTo(wt); err != nil {
+	_, _ = buf.WriteString(encoded)
+	fs.writeTo(buf)
+	_, _ = buf.WriteRune('\n')
+	return buf.String()
+}
+
+// Encode encodes the fields in the format of ToString without a message and
+// without the trailing line break. Values get evaluated at the time of the
+// call, for example of StringFn or Marshaler fields. Concatenating encoded
+// fields equals encoding all fields at once.
+func (fs Fields) Encode() string {
+	if len(fs) == 0 {
+		return ""
+	}
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+	fs.writeTo(buf)
+	return buf.String()
+}
+
+func (fs Fields) writeTo(buf *bytes.Buffer) {
+	if err := fs.AddTo(WriteTypes{W: buf}); err != nil {
 		_, _ = buf.WriteString(Separator)
 		_, _ = buf.WriteString(KeyNameError)
 		_, _ = buf.WriteString(AssignmentChar)
 		_, _ = buf.WriteString(fmt.Sprintf("%+v", err))
 	}
-	_, _ = buf.WriteRune('\n')
-	return buf.String()
 }
 
 // field is a deferred marshaling operation used to add a key-value pair to
@@ -62,6 +62,16 @@ func TestFields_ToString(t *testing.T) {
 	assert.Exactly(t, "fieldsKey k1: \"v1\" k2: 2 k3: 3.14159 k4: \"chan uint64\"\n", str)
 }
 
+func TestFields_Encode(t *testing.T) {
+	ctx := Fields{String("k1", "v1"), Int("k2", 2)}
+	fs := Fields{Float64("k3", 3.14159)}
+
+	assert.Exactly(t, "", Fields{}.Encode())
+	assert.Exactly(t, " k1: \"v1\" k2: 2", ctx.Encode())
+	assert.Exactly(t, append(ctx, fs...).ToString("msg"), fs.ToStringEncoded("msg", ctx.Encode()))
+	assert.Exactly(t, Fields{String("k1", "v1")}.Encode()+Fields{Int("k2", 2)}.Encode(), ctx.Encode())
+}
+
 func TestFields_ToString_Error(t *testing.T) {
 	fs := Fields{
 		Text("o1", gs{err: errors.New("ErrToString")}),
@@ -37,7 +37,12 @@ const KeyNameDuration = `duration`
 // details.
 type Logger interface {
 	// With returns a new Logger that has this logger's context plus the given
-	// Fields.
+	// Fields. The fields get evaluated once when With gets called: StringFn,
+	// Stringer and Marshaler fields run at this point and not on each log
+	// call, hence their values stay fixed. Pass changing values to Debug or
+	// Info. If a context field returns an error, the error gets logged with
+	// the key KeyNameError among the context fields, before the fields of the
+	// log call.
 	With(...Field) Logger
 	// Debug outputs information for developers including a stack trace.
 	Debug(msg string, fields ...Field)
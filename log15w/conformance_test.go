@@ -0,0 +1,38 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log15w_test
+
+import (
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/log15w"
+	"github.com/corestoreio/log/logtest"
+	"github.com/inconshreveable/log15"
+)
+
+func TestConformance(t *testing.T) {
+	logtest.Conformance(t, func(t testing.TB, lvl logtest.Level) (log.Logger, func() logtest.Entries) {
+		level := log15.LvlInfo
+		if lvl == logtest.LevelDebug {
+			level = log15.LvlDebug
+		}
+		buf := new(log.MutexBuffer)
+		l := log15w.New(level, log15.LvlFilterHandler(level, log15.StreamHandler(buf, log15.JsonFormat())))
+		return l, func() logtest.Entries {
+			return logtest.DecodeJSON(t, buf.Bytes(), "msg", "lvl")
+		}
+	})
+}
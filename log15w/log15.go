@@ -25,8 +25,6 @@ import (
 type Wrap struct {
 	level  log15.Lvl
 	logger log15.Logger
-	// ctx is only set when we act as a child logger
-	ctx log.Fields
 }
 
 // New creates a new https://godoc.org/github.com/inconshreveable/log15 logger.
@@ -40,22 +38,23 @@ func New(lvl log15.Lvl, h log15.Handler, ctx ...interface{}) *Wrap {
 }
 
 // With creates a new inherited and shallow copied Logger with additional fields
-// added to the logging context.
+// added to the logging context. The fields get converted only once into the
+// context of a log15 child logger.
 func (l *Wrap) With(fields ...log.Field) log.Logger {
 	l2 := new(Wrap)
 	*l2 = *l
-	l2.ctx = append(l2.ctx, fields...)
+	l2.logger = l.logger.New(doLog15FieldWrap(fields...)...)
 	return l2
 }
 
 // Info outputs information for users of the app
 func (l *Wrap) Info(msg string, fields ...log.Field) {
-	l.logger.Info(msg, doLog15FieldWrap(l.ctx, fields...)...)
+	l.logger.Info(msg, doLog15FieldWrap(fields...)...)
 }
 
 // Debug outputs information for developers.
 func (l *Wrap) Debug(msg string, fields ...log.Field) {
-	l.logger.Debug(msg, doLog15FieldWrap(l.ctx, fields...)...)
+	l.logger.Debug(msg, doLog15FieldWrap(fields...)...)
 }
 
 // IsDebug returns true if Debug level is enabled
@@ -72,14 +71,7 @@ type log15FieldWrap struct {
 	ifaces []interface{}
 }
 
-func doLog15FieldWrap(ctx log.Fields, fs ...log.Field) []interface{} {
-	if ctxl := len(ctx); ctxl > 0 {
-		all := make(log.Fields, 0, ctxl+len(fs))
-		all = append(all, ctx...)
-		all = append(all, fs...)
-		fs = all
-	}
-
+func doLog15FieldWrap(fs ...log.Field) []interface{} {
 	fw := &log15FieldWrap{
 		ifaces: make([]interface{}, 0, 6), // just guessing not more than 6 args / 3 Fields
 	}
@@ -16,12 +16,14 @@ package log15w_test
 
 import (
 	"bytes"
+	"io/ioutil"
 	"math"
 	"testing"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/corestoreio/log/log15w"
+	"github.com/corestoreio/log/logtest"
 	"github.com/corestoreio/pkg/util/assert"
 	"github.com/inconshreveable/log15"
 )
@@ -128,3 +130,29 @@ func TestAddMarshaler_Error(t *testing.T) {
 	assert.Contains(t, buf.String(), `"kvfloat64":0`)
 	assert.Contains(t, buf.String(), `"kvstring":""`)
 }
+
+func TestWrap_With_Siblings(t *testing.T) {
+	var ctxs [][]interface{}
+	h := log15.FuncHandler(func(r *log15.Record) error {
+		ctxs = append(ctxs, append([]interface{}{r.Msg}, r.Ctx...))
+		return nil
+	})
+	parent := log15w.New(log15.LvlDebug, h).With(log.String("p", "1"))
+	a := parent.With(log.String("s", "a"))
+	b := parent.With(log.String("s", "b"), log.Int("n", 2))
+	a.Info("a", log.Int("i", 1))
+	b.Debug("b")
+	parent.Info("parent")
+	a.Info("a")
+
+	assert.Exactly(t, [][]interface{}{
+		{"a", "p", "1", "s", "a", "i", 1},
+		{"b", "p", "1", "s", "b", "n", 2},
+		{"parent", "p", "1"},
+		{"a", "p", "1", "s", "a"},
+	}, ctxs)
+}
+
+func BenchmarkWrap_With(b *testing.B) {
+	logtest.BenchmarkWith(b, log15w.New(log15.LvlInfo, log15.StreamHandler(ioutil.Discard, log15.LogfmtFormat())))
+}
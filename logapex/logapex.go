@@ -24,37 +24,36 @@ import (
 
 type Wrap struct {
 	level apx.Level
-	wrap  *apx.Logger
-	// ctx is only set when we act as a child logger
-	ctx log.Fields
+	// entry contains the converted context fields.
+	entry *apx.Entry
 }
 
 // New creates a new https://godoc.org/github.com/apex/log logger.
 func New(lvl apx.Level, l *apx.Logger, fields ...log.Field) *Wrap {
 	return &Wrap{
 		level: lvl,
-		wrap:  l,
-		ctx:   fields,
+		entry: apx.NewEntry(l).WithFields(wrapFields(fields...)),
 	}
 }
 
 // With creates a new inherited and shallow copied Logger with additional fields
-// added to the logging context.
+// added to the logging context. The fields get converted only once into the
+// apex entry of the new logger.
 func (l *Wrap) With(fields ...log.Field) log.Logger {
 	l2 := new(Wrap)
 	*l2 = *l
-	l2.ctx = append(l2.ctx, fields...)
+	l2.entry = l.entry.WithFields(wrapFields(fields...))
 	return l2
 }
 
 // Info outputs information for users of the app
 func (l *Wrap) Info(msg string, fields ...log.Field) {
-	l.wrap.WithFields(wrapFields(l.ctx, fields...)).Info(msg)
+	l.entry.WithFields(wrapFields(fields...)).Info(msg)
 }
 
 // Debug outputs information for developers.
 func (l *Wrap) Debug(msg string, fields ...log.Field) {
-	l.wrap.WithFields(wrapFields(l.ctx, fields...)).Debug(msg)
+	l.entry.WithFields(wrapFields(fields...)).Debug(msg)
 }
 
 // IsDebug returns true if Debug level is enabled
@@ -71,14 +70,7 @@ type fieldWrap struct {
 	apx apx.Fields
 }
 
-func wrapFields(ctx log.Fields, fs ...log.Field) apx.Fields {
-	if ctxl := len(ctx); ctxl > 0 {
-		all := make(log.Fields, 0, ctxl+len(fs))
-		all = append(all, ctx...)
-		all = append(all, fs...)
-		fs = all
-	}
-
+func wrapFields(fs ...log.Field) apx.Fields {
 	fw := &fieldWrap{
 		apx: apx.Fields{},
 	}
@@ -16,6 +16,7 @@ package logapex_test
 
 import (
 	"bytes"
+	"io/ioutil"
 	"math"
 	"testing"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/corestoreio/log/logapex"
+	"github.com/corestoreio/log/logtest"
 	"github.com/corestoreio/pkg/util/assert"
 )
 
@@ -124,3 +126,33 @@ func TestAddMarshaler_Error(t *testing.T) {
 	assert.Contains(t, buf.String(), `"kvfloat64":0`)
 	assert.Contains(t, buf.String(), `"kvstring":""`)
 }
+
+func TestWrap_With_Siblings(t *testing.T) {
+	var entries []apx.Fields
+	h := apx.HandlerFunc(func(e *apx.Entry) error {
+		fs := apx.Fields{"msg": e.Message}
+		for k, v := range e.Fields {
+			fs[k] = v
+		}
+		entries = append(entries, fs)
+		return nil
+	})
+	parent := logapex.New(apx.DebugLevel, &apx.Logger{Handler: h, Level: apx.DebugLevel}).With(log.String("p", "1"))
+	a := parent.With(log.String("s", "a"))
+	b := parent.With(log.String("s", "b"), log.Int("n", 2))
+	a.Info("a", log.Int("i", 1))
+	b.Debug("b")
+	parent.Info("parent")
+	a.Info("a")
+
+	assert.Exactly(t, []apx.Fields{
+		{"msg": "a", "p": "1", "s": "a", "i": 1},
+		{"msg": "b", "p": "1", "s": "b", "n": 2},
+		{"msg": "parent", "p": "1"},
+		{"msg": "a", "p": "1", "s": "a"},
+	}, entries)
+}
+
+func BenchmarkWrap_With(b *testing.B) {
+	logtest.BenchmarkWith(b, logapex.New(apx.InfoLevel, &apx.Logger{Handler: json.New(ioutil.Discard), Level: apx.InfoLevel}))
+}
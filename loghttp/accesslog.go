@@ -0,0 +1,395 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// KeyNameRequestID defines the official key name of the request ID in the log
+// stream.
+const KeyNameRequestID = `request_id`
+
+// HeaderRequestID defines the default HTTP header name which transports the
+// request ID.
+const HeaderRequestID = `X-Request-Id`
+
+// AccessEntry contains the collected data of one served request. It gets
+// passed to each AccessField to create the log fields.
+type AccessEntry struct {
+	Request *http.Request
+	// Route contains the matched route pattern, if a route function has been
+	// configured.
+	Route string
+	// Status contains the written HTTP status code. Defaults to 200 if the
+	// handler did not call WriteHeader, 500 if it panicked before and 101 if
+	// it hijacked the connection before. Informational 1xx codes get ignored.
+	Status int
+	// Bytes contains the number of written body bytes.
+	Bytes int64
+	// ResponseHeader contains the headers written by the handler.
+	ResponseHeader http.Header
+	// Start defines the time when the request has been received.
+	Start time.Time
+	// Duration is the time between Start and the return of the handler.
+	Duration time.Duration
+	// RemoteIP contains the client IP address with applied trusted proxies.
+	RemoteIP string
+	// RequestID contains the ID of the request, if any.
+	RequestID string
+}
+
+// AccessField creates a log field from the data of a served request.
+type AccessField func(*AccessEntry) log.Field
+
+// AccessMethod logs the request method under the key "method".
+func AccessMethod(ae *AccessEntry) log.Field { return log.String("method", ae.Request.Method) }
+
+// AccessPath logs the request URL path under the key "path".
+func AccessPath(ae *AccessEntry) log.Field { return log.String("path", ae.Request.URL.Path) }
+
+// AccessRoute logs the matched route pattern under the key "route".
+func AccessRoute(ae *AccessEntry) log.Field { return log.String("route", ae.Route) }
+
+// AccessStatus logs the response status code under the key "status".
+func AccessStatus(ae *AccessEntry) log.Field { return log.Int("status", ae.Status) }
+
+// AccessBytes logs the amount of written response body bytes under the key
+// "bytes".
+func AccessBytes(ae *AccessEntry) log.Field { return log.Int64("bytes", ae.Bytes) }
+
+// AccessDuration logs the latency of the handler under the key
+// log.KeyNameDuration.
+func AccessDuration(ae *AccessEntry) log.Field {
+	return log.Duration(log.KeyNameDuration, ae.Duration)
+}
+
+// AccessRemoteIP logs the client IP address under the key "remote_ip".
+func AccessRemoteIP(ae *AccessEntry) log.Field { return log.String("remote_ip", ae.RemoteIP) }
+
+// AccessUserAgent logs the user agent under the key "user_agent".
+func AccessUserAgent(ae *AccessEntry) log.Field {
+	return log.String("user_agent", ae.Request.UserAgent())
+}
+
+// AccessRequestID logs the request ID under the key KeyNameRequestID.
+func AccessRequestID(ae *AccessEntry) log.Field { return log.String(KeyNameRequestID, ae.RequestID) }
+
+// DefaultAccessFields defines the fields logged by AccessLog if no other
+// fields have been configured.
+var DefaultAccessFields = []AccessField{
+	AccessMethod, AccessPath, AccessRoute, AccessStatus, AccessBytes,
+	AccessDuration, AccessRemoteIP, AccessUserAgent, AccessRequestID,
+}
+
+type accessLog struct {
+	msg            string
+	fields         []AccessField
+	skip           func(*http.Request) bool
+	route          func(*http.Request) string
+	requestID      func(*http.Request, http.Header) string
+	trustedProxies []*net.IPNet
+}
+
+// AccessLogOption can be used as an argument in AccessLog to configure the
+// middleware.
+type AccessLogOption func(*accessLog)
+
+// WithAccessMessage sets the message of each access log entry.
+func WithAccessMessage(msg string) AccessLogOption {
+	return func(al *accessLog) {
+		al.msg = msg
+	}
+}
+
+// WithAccessFields replaces the default set of logged fields.
+func WithAccessFields(fields ...AccessField) AccessLogOption {
+	return func(al *accessLog) {
+		al.fields = fields
+	}
+}
+
+// WithAccessSkip sets a predicate to skip logging of requests, for example
+// health checks. If the function returns true, no entry gets created.
+func WithAccessSkip(fn func(*http.Request) bool) AccessLogOption {
+	return func(al *accessLog) {
+		al.skip = fn
+	}
+}
+
+// WithAccessRoute sets a function which returns the matched route pattern of
+// a request. It gets called after the handler has been run, so routers which
+// store their pattern in the request context can be used.
+func WithAccessRoute(fn func(*http.Request) string) AccessLogOption {
+	return func(al *accessLog) {
+		al.route = fn
+	}
+}
+
+// WithAccessRequestID sets a function which returns the request ID. The
+// response header argument contains the headers written by the handler. The
+// default function reads the ID stored by the RequestID middleware in the
+// request context, then the HeaderRequestID from the request and falls back to
+// the response header.
+func WithAccessRequestID(fn func(r *http.Request, resHeader http.Header) string) AccessLogOption {
+	return func(al *accessLog) {
+		al.requestID = fn
+	}
+}
+
+// WithTrustedProxies sets the IP addresses or CIDR ranges of proxies whose
+// X-Forwarded-For header can be trusted. Panics if an entry cannot be parsed
+// because this is a configuration error.
+func WithTrustedProxies(ipsOrCIDRs ...string) AccessLogOption {
+	nets, err := ParseTrustedProxies(ipsOrCIDRs...)
+	if err != nil {
+		panic(err)
+	}
+	return func(al *accessLog) {
+		al.trustedProxies = nets
+	}
+}
+
+// SkipPaths returns a predicate for WithAccessSkip which skips all requests
+// matching exactly one of the URL paths.
+func SkipPaths(paths ...string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		for _, p := range paths {
+			if r.URL.Path == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func newAccessLog(opts ...AccessLogOption) *accessLog {
+	al := &accessLog{
+		msg:    "[loghttp] access",
+		fields: DefaultAccessFields,
+		requestID: func(r *http.Request, resHeader http.Header) string {
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				return id
+			}
+			if id := r.Header.Get(HeaderRequestID); id != "" {
+				return id
+			}
+			return resHeader.Get(HeaderRequestID)
+		},
+	}
+	for _, o := range opts {
+		o(al)
+	}
+	return al
+}
+
+// serve runs the handler, collects the data of the request and passes it to
+// done. done does not get called if the request should be skipped. A panic
+// of the handler gets passed on after done has been called, so the request
+// gets logged anyway.
+func (al *accessLog) serve(next http.Handler, w http.ResponseWriter, r *http.Request, done func(*AccessEntry)) {
+	if al.skip != nil && al.skip(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	ae := &AccessEntry{
+		Request: r,
+		Start:   log.Now(),
+	}
+	rw := newResponseWriter(w)
+	defer func() {
+		rec := recover()
+		ae.Duration = log.Now().Sub(ae.Start)
+		ae.Status = rw.Status()
+		if rec != nil && rw.status == 0 {
+			ae.Status = http.StatusInternalServerError
+		}
+		ae.Bytes = rw.bytes
+		ae.ResponseHeader = rw.Header()
+		ae.RemoteIP = RemoteIP(r, al.trustedProxies)
+		if al.route != nil {
+			ae.Route = al.route(r)
+		}
+		if al.requestID != nil {
+			ae.RequestID = al.requestID(r, rw.Header())
+		}
+		done(ae)
+		if rec != nil {
+			panic(rec)
+		}
+	}()
+	next.ServeHTTP(rw, r)
+}
+
+// AccessLog returns a middleware which logs one structured entry with Info
+// level per served request, also if the handler panics. The logged fields can
+// be configured with WithAccessFields, by default DefaultAccessFields gets
+// used. If Info level has been disabled, the handler runs without any
+// overhead.
+func AccessLog(l log.Logger, opts ...AccessLogOption) func(http.Handler) http.Handler {
+	al := newAccessLog(opts...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.IsInfo() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			al.serve(next, w, r, func(ae *AccessEntry) {
+				fs := make(log.Fields, 0, len(al.fields))
+				for _, af := range al.fields {
+					fs = append(fs, af(ae))
+				}
+				l.Info(al.msg, fs...)
+			})
+		})
+	}
+}
+
+// ParseTrustedProxies parses IP addresses or CIDR ranges. A single IP address
+// gets converted into a host-only network.
+func ParseTrustedProxies(ipsOrCIDRs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(ipsOrCIDRs))
+	for _, s := range ipsOrCIDRs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.NotValid.Newf("[loghttp] Invalid trusted proxy IP address: %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.NotValid.New(err, "[loghttp] Invalid trusted proxy CIDR: %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	pip := net.ParseIP(ip)
+	if pip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(pip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteIP returns the IP address of the client. The X-Forwarded-For header
+// only gets evaluated if the direct peer is a trusted proxy. The header gets
+// walked from right to left and the first untrusted address gets returned.
+func RemoteIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if len(trusted) == 0 || !isTrusted(ip, trusted) {
+		return ip
+	}
+	xff := r.Header.Values("X-Forwarded-For")
+	for i := len(xff) - 1; i >= 0; i-- {
+		hops := strings.Split(xff[i], ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			hop := strings.TrimSpace(hops[j])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !isTrusted(hop, trusted) {
+				return ip
+			}
+		}
+	}
+	return ip
+}
+
+// responseWriter records the status code and the written bytes of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// Status returns the written status code or 200 if no status has been
+// written.
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	// Informational headers can be written several times before the final
+	// status, only 101 switches the protocol.
+	if rw.status == 0 && (code < 100 || code > 199 || code == http.StatusSwitchingProtocols) {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer supports it.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying writer supports it.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.NotSupported.Newf("[loghttp] ResponseWriter does not implement http.Hijacker")
+	}
+	conn, brw, err := h.Hijack()
+	if err == nil && rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the original ResponseWriter, used by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,162 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	mw := loghttp.AccessLog(lg,
+		loghttp.WithAccessSkip(loghttp.SkipPaths("/healthz")),
+		loghttp.WithAccessRoute(func(r *http.Request) string { return "/users/{id}" }),
+		loghttp.WithTrustedProxies("10.0.0.0/8", "192.168.0.1"),
+	)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(loghttp.HeaderRequestID, "rid-123")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`Hello Gopher`))
+	}))
+
+	req := httptest.NewRequest("POST", "http://corestore.io/users/42?x=y", nil)
+	req.RemoteAddr = "192.168.0.1:3456"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.1.2.3")
+	req.Header.Set("User-Agent", "GopherBot")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Exactly(t, http.StatusCreated, rec.Code)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Contains(t, buf.String(), `INFO [loghttp] access method: "POST" path: "/users/42" route: "/users/{id}" status: 201 bytes: 12 duration: `)
+	assert.Contains(t, buf.String(), `remote_ip: "203.0.113.7" user_agent: "GopherBot" request_id: "rid-123"`)
+	assert.NotContains(t, buf.String(), `healthz`)
+}
+
+func TestAccessLog_Fields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	h := loghttp.AccessLog(lg,
+		loghttp.WithAccessMessage("served"),
+		loghttp.WithAccessFields(loghttp.AccessStatus, func(ae *loghttp.AccessEntry) log.Field {
+			return log.String("proto", ae.Request.Proto)
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Exactly(t, "INFO served status: 200 proto: \"HTTP/1.1\"\n", buf.String())
+}
+
+func TestAccessLog_Panic(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	h := loghttp.AccessLog(lg, loghttp.WithAccessFields(loghttp.AccessPath, loghttp.AccessStatus))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+	assert.Panics(t, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/crash", nil))
+	}, "The panic must be passed on")
+	assert.Exactly(t, "INFO [loghttp] access path: \"/crash\" status: 500\n", buf.String())
+}
+
+func TestAccessLog_Informational(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	h := loghttp.AccessLog(lg, loghttp.WithAccessFields(loghttp.AccessStatus))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", "</style.css>; rel=preload")
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Exactly(t, "INFO [loghttp] access status: 202\n", buf.String())
+}
+
+// hijackRecorder implements http.Hijacker.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestAccessLog_Hijack(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	h := loghttp.AccessLog(lg, loghttp.WithAccessFields(loghttp.AccessStatus))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _, err := w.(http.Hijacker).Hijack()
+			assert.NoError(t, err)
+		}))
+	h.ServeHTTP(hijackRecorder{httptest.NewRecorder()}, httptest.NewRequest("GET", "/ws", nil))
+	assert.Exactly(t, "INFO [loghttp] access status: 101\n", buf.String())
+}
+
+func TestAccessLog_InfoDisabled(t *testing.T) {
+	var called bool
+	h := loghttp.AccessLog(log.BlackHole{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, called = w.(*httptest.ResponseRecorder)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, called, "ResponseWriter should not be wrapped")
+}
+
+func TestRemoteIP(t *testing.T) {
+	trusted, err := loghttp.ParseTrustedProxies("10.0.0.0/8", "2001:db8::1")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"203.0.113.7:80", "1.2.3.4", "203.0.113.7"},
+		{"10.0.0.1:80", "", "10.0.0.1"},
+		{"10.0.0.1:80", "1.2.3.4, 5.6.7.8, 10.9.9.9", "5.6.7.8"},
+		{"10.0.0.1:80", "10.1.1.1, 10.2.2.2", "10.1.1.1"},
+		{"[2001:db8::1]:80", "1.2.3.4", "1.2.3.4"},
+		{"unix", "1.2.3.4", "unix"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+		assert.Exactly(t, test.want, loghttp.RemoteIP(req, trusted), "%#v", test)
+	}
+
+	_, err = loghttp.ParseTrustedProxies("10.0.0.0/88")
+	assert.Error(t, err)
+}
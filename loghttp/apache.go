@@ -0,0 +1,290 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/corestoreio/errors"
+)
+
+// Apache log format strings for the function ParseLogFormat.
+const (
+	// FormatCommon defines the NCSA Common Log Format.
+	FormatCommon = `%h %l %u %t "%r" %>s %b`
+	// FormatCombined defines the NCSA Combined Log Format.
+	FormatCombined = FormatCommon + ` "%{Referer}i" "%{User-Agent}i"`
+)
+
+// apacheTimeLayout defines the time layout of the %t directive.
+const apacheTimeLayout = `[02/Jan/2006:15:04:05 -0700]`
+
+// LogFormat contains a parsed Apache log format string. It is safe for
+// concurrent use.
+type LogFormat struct {
+	// Redactor replaces secrets in the directives %r, %q, %{Name}i and
+	// %{Name}o. ParseLogFormat sets it to the DefaultRedactor. If nil, nothing
+	// gets replaced. It must not be changed while logging.
+	Redactor *Redactor
+	parts    []formatPart
+}
+
+type formatPart struct {
+	literal   string
+	directive byte
+	arg       string
+}
+
+// ParseLogFormat parses a format string with Apache mod_log_config
+// directives. Supported directives:
+//
+//	%%          the percent sign
+//	%a, %h      remote IP address, with applied trusted proxies
+//	%A          local IP address
+//	%b          response bytes, "-" when zero
+//	%B          response bytes
+//	%D          duration in microseconds
+//	%{UNIT}T    duration in seconds; UNIT can be ms, us or s
+//	%H          request protocol
+//	%{Name}i    request header, or "-"
+//	%l          remote logname, always "-"
+//	%m          request method
+//	%{Name}o    response header, or "-"
+//	%p          server port
+//	%q          query string prefixed with "?", or empty
+//	%r          first line of the request
+//	%s, %>s     response status
+//	%t          request start time in the common log format
+//	%{LAYOUT}t  request start time; LAYOUT can be sec, msec, usec or a Go time layout
+//	%u          remote user of the basic authentication, or "-"
+//	%U          URL path
+//	%v, %V      host name of the request
+//	%L          request ID
+//
+// The modifiers < and > get accepted and ignored. Status code conditions are
+// not supported. Secret headers and query parameters get replaced by the
+// DefaultRedactor.
+func ParseLogFormat(format string) (*LogFormat, error) {
+	lf := &LogFormat{Redactor: DefaultRedactor}
+	var lit []byte
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			lit = append(lit, c)
+			continue
+		}
+		i++
+		if i >= len(format) {
+			return nil, errors.NotValid.Newf("[loghttp] ParseLogFormat: Dangling %% at the end of %q", format)
+		}
+		if format[i] == '%' {
+			lit = append(lit, '%')
+			continue
+		}
+		var arg string
+		if format[i] == '{' {
+			end := i + 1
+			for end < len(format) && format[end] != '}' {
+				end++
+			}
+			if end >= len(format) {
+				return nil, errors.NotValid.Newf("[loghttp] ParseLogFormat: Missing closing brace in %q", format)
+			}
+			arg = format[i+1 : end]
+			i = end + 1
+		}
+		for i < len(format) && (format[i] == '<' || format[i] == '>') {
+			i++
+		}
+		if i >= len(format) {
+			return nil, errors.NotValid.Newf("[loghttp] ParseLogFormat: Missing directive at the end of %q", format)
+		}
+		d := format[i]
+		switch d {
+		case 'a', 'A', 'b', 'B', 'D', 'h', 'H', 'l', 'm', 'p', 'q', 'r', 's', 't', 'T', 'u', 'U', 'v', 'V', 'L':
+		case 'i', 'o':
+			if arg == "" {
+				return nil, errors.NotValid.Newf("[loghttp] ParseLogFormat: Directive %%%c requires a header name in %q", d, format)
+			}
+		default:
+			return nil, errors.NotSupported.Newf("[loghttp] ParseLogFormat: Directive %%%c not supported in %q", d, format)
+		}
+		if len(lit) > 0 {
+			lf.parts = append(lf.parts, formatPart{literal: string(lit)})
+			lit = lit[:0]
+		}
+		lf.parts = append(lf.parts, formatPart{directive: d, arg: arg})
+	}
+	if len(lit) > 0 {
+		lf.parts = append(lf.parts, formatPart{literal: string(lit)})
+	}
+	return lf, nil
+}
+
+// MustParseLogFormat same as ParseLogFormat but panics on error.
+func MustParseLogFormat(format string) *LogFormat {
+	lf, err := ParseLogFormat(format)
+	if err != nil {
+		panic(err)
+	}
+	return lf
+}
+
+// AppendEntry appends the formatted entry to buf and returns the extended
+// buffer. A line break does not get appended.
+func (lf *LogFormat) AppendEntry(buf []byte, ae *AccessEntry) []byte {
+	r := ae.Request
+	for _, p := range lf.parts {
+		switch p.directive {
+		case 0:
+			buf = append(buf, p.literal...)
+		case 'a', 'h':
+			buf = appendOrDash(buf, ae.RemoteIP)
+		case 'A':
+			var ip string
+			if la, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+				ip, _, _ = net.SplitHostPort(la.String())
+			}
+			buf = appendOrDash(buf, ip)
+		case 'b':
+			if ae.Bytes == 0 {
+				buf = append(buf, '-')
+			} else {
+				buf = strconv.AppendInt(buf, ae.Bytes, 10)
+			}
+		case 'B':
+			buf = strconv.AppendInt(buf, ae.Bytes, 10)
+		case 'D':
+			buf = strconv.AppendInt(buf, ae.Duration.Microseconds(), 10)
+		case 'T':
+			switch p.arg {
+			case "ms":
+				buf = strconv.AppendInt(buf, ae.Duration.Milliseconds(), 10)
+			case "us":
+				buf = strconv.AppendInt(buf, ae.Duration.Microseconds(), 10)
+			default:
+				buf = strconv.AppendInt(buf, int64(ae.Duration.Seconds()), 10)
+			}
+		case 'H':
+			buf = append(buf, r.Proto...)
+		case 'i':
+			buf = appendOrDash(buf, lf.Redactor.headerValue(r.Header, p.arg))
+		case 'l':
+			buf = append(buf, '-')
+		case 'm':
+			buf = append(buf, r.Method...)
+		case 'o':
+			buf = appendOrDash(buf, lf.Redactor.headerValue(ae.ResponseHeader, p.arg))
+		case 'p':
+			var port string
+			if la, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+				_, port, _ = net.SplitHostPort(la.String())
+			}
+			if port == "" {
+				_, port, _ = net.SplitHostPort(r.Host)
+			}
+			buf = appendOrDash(buf, port)
+		case 'q':
+			if u := lf.Redactor.URL(r.URL); u.RawQuery != "" {
+				buf = append(buf, '?')
+				buf = appendEscaped(buf, u.RawQuery)
+			}
+		case 'r':
+			buf = append(buf, r.Method...)
+			buf = append(buf, ' ')
+			buf = appendEscaped(buf, lf.Redactor.URL(r.URL).RequestURI())
+			buf = append(buf, ' ')
+			buf = append(buf, r.Proto...)
+		case 's':
+			buf = strconv.AppendInt(buf, int64(ae.Status), 10)
+		case 't':
+			switch p.arg {
+			case "":
+				buf = ae.Start.AppendFormat(buf, apacheTimeLayout)
+			case "sec":
+				buf = strconv.AppendInt(buf, ae.Start.Unix(), 10)
+			case "msec":
+				buf = strconv.AppendInt(buf, ae.Start.UnixNano()/1e6, 10)
+			case "usec":
+				buf = strconv.AppendInt(buf, ae.Start.UnixNano()/1e3, 10)
+			default:
+				buf = ae.Start.AppendFormat(buf, p.arg)
+			}
+		case 'u':
+			user, _, _ := r.BasicAuth()
+			buf = appendOrDash(buf, user)
+		case 'U':
+			buf = appendEscaped(buf, r.URL.Path)
+		case 'v', 'V':
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			buf = appendEscaped(buf, host)
+		case 'L':
+			buf = appendOrDash(buf, ae.RequestID)
+		}
+	}
+	return buf
+}
+
+func appendOrDash(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	return appendEscaped(buf, s)
+}
+
+// appendEscaped escapes quotes, backslashes and non-printable characters the
+// same way as Apache does.
+func appendEscaped(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c >= 0x7f:
+			buf = append(buf, '\\', 'x', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// ApacheLog returns a middleware which writes one line per served request in
+// the format of `lf` to `w`. Writes to `w` get serialized, one Write call per
+// line. Write errors get ignored. The options WithAccessSkip, WithAccessRoute,
+// WithAccessRequestID and WithTrustedProxies are supported.
+func ApacheLog(w io.Writer, lf *LogFormat, opts ...AccessLogOption) func(http.Handler) http.Handler {
+	al := newAccessLog(opts...)
+	var mu sync.Mutex
+	var buf []byte
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			al.serve(next, rw, r, func(ae *AccessEntry) {
+				mu.Lock()
+				buf = lf.AppendEntry(buf[:0], ae)
+				buf = append(buf, '\n')
+				_, _ = w.Write(buf)
+				mu.Unlock()
+			})
+		})
+	}
+}
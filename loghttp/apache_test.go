@@ -0,0 +1,95 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+const (
+	productURL = "http://corestore.io:8080/catalog/product?id=4711"
+	loginURL   = "http://corestore.io:8080/login?token=s3cr3t&id=4711"
+)
+
+func serveApacheLog(t *testing.T, lf *loghttp.LogFormat, target string) string {
+	now := log.Now
+	defer func() { log.Now = now }()
+	start := time.Date(2009, 11, 10, 23, 4, 5, 0, time.FixedZone("CET", 3600))
+	log.Now = func() time.Time { return start }
+
+	buf := new(log.MutexBuffer)
+	h := loghttp.ApacheLog(buf, lf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache", "HIT")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`not found`))
+	}))
+
+	req := httptest.NewRequest("GET", target, nil)
+	req.RemoteAddr = "203.0.113.7:50000"
+	req.SetBasicAuth("gopher", "secret")
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `Go "test" client`)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestApacheLog(t *testing.T) {
+	t.Run("common", func(t *testing.T) {
+		assert.Exactly(t,
+			"203.0.113.7 - gopher [10/Nov/2009:23:04:05 +0100] \"GET /catalog/product?id=4711 HTTP/1.1\" 404 9\n",
+			serveApacheLog(t, loghttp.MustParseLogFormat(loghttp.FormatCommon), productURL))
+	})
+	t.Run("combined", func(t *testing.T) {
+		assert.Exactly(t,
+			"203.0.113.7 - gopher [10/Nov/2009:23:04:05 +0100] \"GET /catalog/product?id=4711 HTTP/1.1\" 404 9 \"https://example.com/\" \"Go \\\"test\\\" client\"\n",
+			serveApacheLog(t, loghttp.MustParseLogFormat(loghttp.FormatCombined), productURL))
+	})
+	t.Run("custom", func(t *testing.T) {
+		assert.Exactly(t,
+			"100% GET /catalog/product ?id=4711 corestore.io:8080 cache=HIT t=1257890645 D=0 L=-\n",
+			serveApacheLog(t, loghttp.MustParseLogFormat(`100%% %m %U %q %v:%p cache=%{X-Cache}o t=%{sec}t D=%D L=%L`), productURL))
+	})
+	t.Run("missing headers", func(t *testing.T) {
+		assert.Exactly(t,
+			"\"-\" \"-\"\n",
+			serveApacheLog(t, loghttp.MustParseLogFormat(`"%{X-Missing}i" "%{X-Missing}o"`), productURL))
+	})
+	t.Run("redacted", func(t *testing.T) {
+		assert.Exactly(t,
+			"\"GET /login?id=4711&token=REDACTED HTTP/1.1\" ?id=4711&token=REDACTED REDACTED\n",
+			serveApacheLog(t, loghttp.MustParseLogFormat(`"%r" %q %{Authorization}i`), loginURL))
+	})
+	t.Run("not redacted", func(t *testing.T) {
+		lf := loghttp.MustParseLogFormat(`"%r" %{Authorization}i`)
+		lf.Redactor = nil
+		assert.Exactly(t,
+			"\"GET /login?token=s3cr3t&id=4711 HTTP/1.1\" Basic Z29waGVyOnNlY3JldA==\n",
+			serveApacheLog(t, lf, loginURL))
+	})
+}
+
+func TestParseLogFormat_Error(t *testing.T) {
+	for _, format := range []string{`%`, `%{Referer`, `%{Referer}`, `%i`, `%Z`} {
+		_, err := loghttp.ParseLogFormat(format)
+		assert.Error(t, err, format)
+	}
+}
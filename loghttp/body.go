@@ -0,0 +1,136 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/corestoreio/errors"
+)
+
+// DefaultMaxBodySize defines a recommended value for Dumper.MaxBodySize. The
+// DefaultDumper does not limit the body size.
+const DefaultMaxBodySize = 64 << 10
+
+// DefaultDumpContentTypes contains the textual media types recommended for
+// Dumper.ContentTypes. Binary and multipart bodies get omitted. The
+// DefaultDumper dumps all content types.
+var DefaultDumpContentTypes = []string{
+	"text/*",
+	"application/json", "application/*+json",
+	"application/xml", "application/*+xml",
+	"application/x-www-form-urlencoded",
+	"application/javascript", "application/graphql",
+}
+
+// allowContentType reports whether the body of the media type contentType
+// gets dumped.
+func (d *Dumper) allowContentType(contentType string) bool {
+	if len(d.ContentTypes) == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range d.ContentTypes {
+		if ok, _ := path.Match(pattern, mt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpBody appends the redacted and capped body to dump. It returns a
+// ReadCloser which must replace rc because rc might have been read. The
+// returned ReadCloser yields the full original content, even if an error
+// occurred. Closing it closes rc.
+func (d *Dumper) dumpBody(dump []byte, h http.Header, rc io.ReadCloser, contentLength int64) ([]byte, io.ReadCloser, error) {
+	if rc == nil || rc == http.NoBody {
+		return dump, rc, nil
+	}
+	header := h.Get("Content-Type")
+	ct := header
+	if ct != "" && !d.allowContentType(ct) {
+		return appendOmitted(dump, ct), rc, nil
+	}
+	prefix, body, truncated, err := peekBody(rc, d.MaxBodySize)
+	if err != nil {
+		return nil, body, errors.WithStack(err)
+	}
+	if ct == "" {
+		ct = http.DetectContentType(prefix)
+		if !d.allowContentType(ct) {
+			return appendOmitted(dump, ct), body, nil
+		}
+	}
+	// The redacted prefix has a different length, hence the number of
+	// truncated bytes derives from the raw prefix.
+	remaining := int64(-1)
+	if truncated && contentLength > int64(len(prefix)) {
+		remaining = contentLength - int64(len(prefix))
+	}
+	// Without a header, the Redactor detects secrets by their keys.
+	dump = append(dump, d.Redactor.Body(header, prefix)...)
+	return appendTruncated(dump, truncated, remaining), body, nil
+}
+
+// peekBody reads up to max bytes from rc, or everything if max is zero. The
+// returned ReadCloser yields the full original content, even if an error
+// occurred. Closing it closes rc, peekBody itself never closes rc because the
+// body belongs to the handler. truncated reports whether rc contains more
+// than max bytes.
+func peekBody(rc io.ReadCloser, max int64) (prefix []byte, body io.ReadCloser, truncated bool, err error) {
+	var buf bytes.Buffer
+	var r io.Reader = rc
+	if max > 0 {
+		r = io.LimitReader(rc, max+1)
+	}
+	_, err = buf.ReadFrom(r)
+	peeked := buf.Bytes()
+	body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), rc), rc}
+	if max > 0 && int64(len(peeked)) > max {
+		return peeked[:max], body, true, errors.WithStack(err)
+	}
+	return peeked, body, false, errors.WithStack(err)
+}
+
+// appendTruncated appends a marker to a dump if the body has been truncated.
+// The marker contains the number of remaining bytes, if not negative.
+func appendTruncated(dump []byte, truncated bool, remaining int64) []byte {
+	if !truncated {
+		return dump
+	}
+	if remaining >= 0 {
+		dump = append(dump, "\n[truncated "...)
+		dump = strconv.AppendInt(dump, remaining, 10)
+		return append(dump, " bytes]"...)
+	}
+	return append(dump, "\n[truncated]"...)
+}
+
+func appendOmitted(dump []byte, contentType string) []byte {
+	dump = append(dump, "[omitted body of content type "...)
+	dump = append(dump, contentType...)
+	return append(dump, ']')
+}
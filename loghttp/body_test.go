@@ -0,0 +1,117 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func dumpRequest(t *testing.T, d *loghttp.Dumper, contentType, body string) (dump, readBody string) {
+	req := httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	buf := &bytes.Buffer{}
+	if err := d.Request(testKey, req).AddTo(log.WriteTypes{W: buf}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	return buf.String(), string(b)
+}
+
+func TestDumper_MaxBodySize(t *testing.T) {
+	d := &loghttp.Dumper{MaxBodySize: 10}
+	const data = `0123456789abcdefghij`
+
+	dump, body := dumpRequest(t, d, "text/plain", data)
+	assert.Contains(t, dump, `\r\n\r\n0123456789\n[truncated 10 bytes]"`)
+	assert.Exactly(t, data, body, "Body must be fully readable")
+
+	dump, body = dumpRequest(t, d, "text/plain", data[:10])
+	assert.Contains(t, dump, `\r\n\r\n0123456789"`)
+	assert.NotContains(t, dump, `truncated`)
+	assert.Exactly(t, data[:10], body)
+}
+
+func TestDumper_MaxBodySize_Redacted(t *testing.T) {
+	d := &loghttp.Dumper{Redactor: loghttp.DefaultRedactor, MaxBodySize: 30}
+
+	form := "password=" + strings.Repeat("s", 40) + "&name=" + strings.Repeat("n", 82)
+	dump, body := dumpRequest(t, d, "application/x-www-form-urlencoded", form)
+	assert.Len(t, form, 137)
+	assert.Contains(t, dump, `password=REDACTED\n[truncated 107 bytes]"`)
+	assert.Exactly(t, form, body, "Body must be fully readable")
+
+	// Truncated JSON gets redacted field by field, the count still refers to
+	// the raw body.
+	js := `{"token":"` + strings.Repeat("t", 40) + `"}`
+	dump, body = dumpRequest(t, d, "application/json", js)
+	assert.Contains(t, dump, `\r\n\r\n{\"token\":\"REDACTED\"\n[truncated 22 bytes]"`)
+	assert.Exactly(t, js, body)
+}
+
+func TestDumper_Redacted_WithoutContentType(t *testing.T) {
+	d := &loghttp.Dumper{Redactor: loghttp.DefaultRedactor}
+
+	dump, body := dumpRequest(t, d, "", `password=s3cr3t&name=bob`)
+	assert.Contains(t, dump, `\r\n\r\nname=bob&password=REDACTED"`)
+	assert.Exactly(t, `password=s3cr3t&name=bob`, body)
+
+	dump, _ = dumpRequest(t, d, "", `{"password":"s3cr3t","name":"bob"}`)
+	assert.Contains(t, dump, `\r\n\r\n{\"name\":\"bob\",\"password\":\"REDACTED\"}"`)
+	assert.NotContains(t, dump, `s3cr3t`)
+}
+
+func TestDumper_ContentTypes(t *testing.T) {
+	d := &loghttp.Dumper{ContentTypes: loghttp.DefaultDumpContentTypes}
+
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"application/vnd.api+json", `{"a":1}`, `\r\n\r\n{\"a\":1}"`},
+		{"text/html; charset=utf-8", `<p>Hi</p>`, `\r\n\r\n<p>Hi</p>"`},
+		{"image/png", "\x89PNG\r\n\x1a\n", `\r\n\r\n[omitted body of content type image/png]"`},
+		{"multipart/form-data; boundary=X", "--X\r\n", `\r\n\r\n[omitted body of content type multipart/form-data; boundary=X]"`},
+		{"", "\x89PNG\r\n\x1a\n", `\r\n\r\n[omitted body of content type image/png]"`},
+		{"", `plain text`, `\r\n\r\nplain text"`},
+	}
+	for _, test := range tests {
+		dump, body := dumpRequest(t, d, test.contentType, test.body)
+		assert.Contains(t, dump, test.want, "%#v", test)
+		assert.Exactly(t, test.body, body, "%#v", test)
+	}
+}
+
+func TestDefaultDumper_Unlimited(t *testing.T) {
+	data := strings.Repeat("x", loghttp.DefaultMaxBodySize+10)
+	dump, body := dumpRequest(t, loghttp.DefaultDumper, "text/plain", data)
+	assert.Contains(t, dump, `\r\n\r\n`+data+`"`)
+	assert.NotContains(t, dump, `truncated`)
+	assert.Exactly(t, data, body)
+
+	dump, _ = dumpRequest(t, loghttp.DefaultDumper, "image/png", "\x89PNG")
+	assert.NotContains(t, dump, `omitted`)
+}
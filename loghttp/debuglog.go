@@ -0,0 +1,156 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// HeaderDebugLog defines the default HTTP header name which transports the
+// signed token to enable debug logging for a single request.
+const HeaderDebugLog = `X-Debug-Log`
+
+// CookieDebugLog defines the default cookie name which transports the signed
+// token to enable debug logging for a single request.
+const CookieDebugLog = `debug_log`
+
+// NewDebugToken creates a token which enables debug logging in the DebugLog
+// middleware until the expiry time. The token has the format
+// "<unix expiry>.<hex HMAC-SHA256 of the expiry>".
+func NewDebugToken(secret []byte, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + hex.EncodeToString(debugTokenMAC(secret, exp))
+}
+
+// VerifyDebugToken reports whether the token has been signed with the secret
+// and has not yet expired according to log.Now.
+func VerifyDebugToken(secret []byte, token string) bool {
+	i := strings.IndexByte(token, '.')
+	if len(secret) == 0 || i < 1 {
+		return false
+	}
+	exp, sig := token[:i], token[i+1:]
+	mac, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, debugTokenMAC(secret, exp)) {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	return err == nil && log.Now().Unix() < unix
+}
+
+func debugTokenMAC(secret []byte, exp string) []byte {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte(exp))
+	return h.Sum(nil)
+}
+
+type debugLog struct {
+	secret []byte
+	header string
+	cookie string
+	query  string
+}
+
+// DebugLogOption can be used as an argument in DebugLog to configure the
+// middleware.
+type DebugLogOption func(*debugLog)
+
+// WithDebugLogHeader sets the name of the header which transports the token.
+// Defaults to HeaderDebugLog. An empty name disables the header.
+func WithDebugLogHeader(name string) DebugLogOption {
+	return func(dl *debugLog) {
+		dl.header = name
+	}
+}
+
+// WithDebugLogCookie sets the name of the cookie which transports the token.
+// Defaults to CookieDebugLog. An empty name disables the cookie.
+func WithDebugLogCookie(name string) DebugLogOption {
+	return func(dl *debugLog) {
+		dl.cookie = name
+	}
+}
+
+// WithDebugLogQuery sets the name of the query parameter which transports the
+// token. Disabled by default because URLs end up in access logs and browser
+// histories.
+func WithDebugLogQuery(name string) DebugLogOption {
+	return func(dl *debugLog) {
+		dl.query = name
+	}
+}
+
+// token returns the first non-empty token of the request.
+func (dl *debugLog) token(r *http.Request) string {
+	if dl.header != "" {
+		if t := r.Header.Get(dl.header); t != "" {
+			return t
+		}
+	}
+	if dl.cookie != "" {
+		if c, err := r.Cookie(dl.cookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	if dl.query != "" {
+		return r.URL.Query().Get(dl.query)
+	}
+	return ""
+}
+
+// DebugLog returns a middleware which enables debug logging for a single
+// request. If the request carries a valid token created by NewDebugToken, the
+// logger debug gets stored in the request context, see FromContext. debug must
+// be configured with Debug level while the global logger stays at Info level,
+// hence IsDebug returns true only for the logger of that request. A request ID
+// stored by the RequestID middleware gets added to the debug logger. Requests
+// without a valid token pass through unchanged. Panics if the secret is empty
+// because this is a configuration error.
+func DebugLog(debug log.Logger, secret []byte, opts ...DebugLogOption) func(http.Handler) http.Handler {
+	if len(secret) == 0 {
+		panic(errors.NotValid.Newf("[loghttp] DebugLog requires a secret"))
+	}
+	dl := &debugLog{
+		secret: secret,
+		header: HeaderDebugLog,
+		cookie: CookieDebugLog,
+	}
+	for _, o := range opts {
+		o(dl)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !VerifyDebugToken(dl.secret, dl.token(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			l := debug
+			id := RequestIDFromContext(r.Context())
+			if id != "" {
+				l = l.With(log.String(KeyNameRequestID, id))
+			}
+			next.ServeHTTP(w, r.WithContext(newContext(r.Context(), l, id != "")))
+		})
+	}
+}
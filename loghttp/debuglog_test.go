@@ -0,0 +1,86 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestVerifyDebugToken(t *testing.T) {
+	now := log.Now
+	defer func() { log.Now = now }()
+	start := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	log.Now = func() time.Time { return start }
+
+	secret := []byte("s3cr3t")
+	tok := loghttp.NewDebugToken(secret, start.Add(time.Minute))
+	assert.Exactly(t, "1488604027.", tok[:11])
+	assert.True(t, loghttp.VerifyDebugToken(secret, tok))
+	assert.False(t, loghttp.VerifyDebugToken([]byte("other"), tok), "Wrong secret")
+	assert.False(t, loghttp.VerifyDebugToken(nil, tok), "Empty secret")
+	assert.False(t, loghttp.VerifyDebugToken(secret, "1588604027"+tok[10:]), "Modified expiry")
+	assert.False(t, loghttp.VerifyDebugToken(secret, ""))
+	assert.False(t, loghttp.VerifyDebugToken(secret, "1.zz"))
+
+	log.Now = func() time.Time { return start.Add(time.Hour) }
+	assert.False(t, loghttp.VerifyDebugToken(secret, tok), "Expired")
+}
+
+func TestDebugLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+	dbg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+	secret := []byte("s3cr3t")
+	tok := loghttp.NewDebugToken(secret, time.Now().Add(time.Minute))
+
+	var isDebug []bool
+	h := loghttp.RequestID(lg)(loghttp.DebugLog(dbg, secret, loghttp.WithDebugLogQuery("debug"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l, _ := loghttp.FromContext(r.Context())
+			isDebug = append(isDebug, l.IsDebug())
+			l.Debug("details", log.Int("n", len(isDebug)))
+		})))
+
+	serve := func(fn func(r *http.Request)) {
+		req := httptest.NewRequest("GET", "/?debug=x", nil)
+		req.Header.Set(loghttp.HeaderRequestID, "req-1")
+		fn(req)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve(func(r *http.Request) {})
+	serve(func(r *http.Request) { r.Header.Set(loghttp.HeaderDebugLog, tok) })
+	serve(func(r *http.Request) { r.AddCookie(&http.Cookie{Name: loghttp.CookieDebugLog, Value: tok}) })
+	serve(func(r *http.Request) { r.URL.RawQuery = "debug=" + tok })
+	serve(func(r *http.Request) { r.Header.Set(loghttp.HeaderDebugLog, tok+"0") })
+
+	assert.Exactly(t, []bool{false, true, true, true, false}, isDebug)
+	assert.Exactly(t, "DEBUG details request_id: \"req-1\" n: 2\n"+
+		"DEBUG details request_id: \"req-1\" n: 3\n"+
+		"DEBUG details request_id: \"req-1\" n: 4\n", buf.String())
+	assert.False(t, lg.IsDebug(), "Global logger must stay at Info level")
+}
+
+func TestDebugLog_EmptySecret(t *testing.T) {
+	assert.Panics(t, func() { loghttp.DebugLog(logw.NewLog(), nil) })
+}
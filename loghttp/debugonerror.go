@@ -0,0 +1,90 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"net/http"
+
+	"github.com/corestoreio/log"
+)
+
+type debugOnError struct {
+	failed  func(status int) bool
+	bufOpts []log.BufferedOption
+}
+
+// DebugOnErrorOption can be used as an argument in DebugOnError to configure
+// the middleware.
+type DebugOnErrorOption func(*debugOnError)
+
+// WithDebugOnErrorFailed sets the function which decides by the response
+// status whether the request failed. Defaults to status >= 500.
+func WithDebugOnErrorFailed(fn func(status int) bool) DebugOnErrorOption {
+	return func(de *debugOnError) {
+		de.failed = fn
+	}
+}
+
+// WithDebugOnErrorBuffer sets the options of the per request log.Buffered.
+func WithDebugOnErrorBuffer(opts ...log.BufferedOption) DebugOnErrorOption {
+	return func(de *debugOnError) {
+		de.bufOpts = opts
+	}
+}
+
+// DebugOnError returns a middleware which stores a log.Buffered per request in
+// the request context, see FromContext. Info entries get written to l, or to
+// the logger already stored in the context, and Debug entries get buffered.
+// The buffer gets flushed to debug if the request failed, the handler logged
+// an error or the handler panicked; otherwise it gets discarded. debug must be
+// configured with Debug level, if nil the Info logger gets used. A request ID
+// stored by the RequestID middleware gets added to the debug logger.
+func DebugOnError(l, debug log.Logger, opts ...DebugOnErrorOption) func(http.Handler) http.Handler {
+	de := &debugOnError{
+		failed: func(status int) bool { return status >= http.StatusInternalServerError },
+	}
+	for _, o := range opts {
+		o(de)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, withID := l, false
+			if cl, ok := FromContext(r.Context()); ok {
+				info, withID = cl, loggerWithRequestID(r.Context())
+			}
+			dl := debug
+			if dl == nil {
+				dl = info
+			} else if id := RequestIDFromContext(r.Context()); id != "" {
+				dl = dl.With(log.String(KeyNameRequestID, id))
+			}
+			b := log.NewBuffered(info, dl, de.bufOpts...)
+			rw := newResponseWriter(w)
+
+			defer func() {
+				if rec := recover(); rec != nil {
+					b.Flush()
+					panic(rec)
+				}
+				if de.failed(rw.Status()) {
+					b.Flush()
+				}
+				b.Discard()
+			}()
+			// The debug logger carries the request ID whenever info does.
+			next.ServeHTTP(rw, r.WithContext(newContext(r.Context(), b, withID)))
+		})
+	}
+}
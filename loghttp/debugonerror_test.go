@@ -0,0 +1,87 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestDebugOnError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+	dbg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+
+	h := loghttp.RequestID(lg)(loghttp.DebugOnError(lg, dbg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, _ := loghttp.FromContext(r.Context())
+		assert.True(t, l.IsDebug())
+		l.Debug("loaded", log.String("path", r.URL.Path))
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/err":
+			l.Info("query", log.Err(errors.New("timeout")))
+		case "/panic":
+			panic("boom")
+		}
+	})))
+
+	serve := func(path string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(loghttp.HeaderRequestID, "req-1")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("/ok")
+	assert.Empty(t, buf.String())
+
+	serve("/fail")
+	assert.Exactly(t, "DEBUG loaded request_id: \"req-1\" path: \"/fail\"\n", buf.String())
+
+	buf.Reset()
+	serve("/err")
+	assert.Exactly(t, "DEBUG loaded request_id: \"req-1\" path: \"/err\"\n"+
+		"INFO query request_id: \"req-1\" error: \"timeout\"\n", buf.String())
+
+	buf.Reset()
+	assert.Panics(t, func() { serve("/panic") })
+	assert.Exactly(t, "DEBUG loaded request_id: \"req-1\" path: \"/panic\"\n", buf.String())
+}
+
+func TestDebugOnError_Options(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+
+	h := loghttp.RequestID(lg)(loghttp.DebugOnError(lg, nil,
+		loghttp.WithDebugOnErrorFailed(func(status int) bool { return status >= 400 }),
+		loghttp.WithDebugOnErrorBuffer(log.WithBufferedMaxEntries(1)),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, _ := loghttp.FromContext(r.Context())
+		l.Debug("a")
+		l.Debug("b")
+		http.NotFound(w, r)
+	})))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(loghttp.HeaderRequestID, "req-2")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Exactly(t, "DEBUG [log] Buffered dropped entries request_id: \"req-2\" dropped: 1\nDEBUG b request_id: \"req-2\"\n", buf.String())
+}
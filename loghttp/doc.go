@@ -12,5 +12,6 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package loghttp creates log fields for http Requests and Responses.
+// Package loghttp creates log fields for http Requests and Responses and
+// provides middleware to log served requests.
 package loghttp
@@ -17,23 +17,148 @@ package loghttp
 import (
 	"net/http"
 	"net/http/httputil"
+	"strings"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 )
 
-func addToHTTPRequest(key string, r *http.Request, dumpBody bool) func(log.AddStringFn) error {
+// Dumper creates log fields from dumped requests and responses. The zero value
+// dumps all bodies completely and without redaction.
+type Dumper struct {
+	// Redactor replaces secrets in headers, URLs and bodies. If nil, nothing
+	// gets replaced.
+	Redactor *Redactor
+	// MaxBodySize limits the dumped body bytes. Larger bodies get truncated
+	// and a marker with the number of truncated bytes gets appended. If zero,
+	// the complete body gets dumped.
+	MaxBodySize int64
+	// ContentTypes contains the media types whose bodies get dumped. Each
+	// entry is a pattern for path.Match, e.g. "text/*" or
+	// "application/*+json". Without a Content-Type header, the media type gets
+	// detected from the body. Omitted bodies get replaced by a marker. If
+	// empty, all bodies get dumped.
+	ContentTypes []string
+}
+
+// DefaultDumper gets used by the package level functions Request,
+// RequestHeader, Response and ResponseHeader and by Transport. It redacts
+// secrets with the DefaultRedactor and dumps all bodies completely. Limits
+// must be enabled explicitly with an own Dumper:
+//
+//	d := &loghttp.Dumper{
+//		Redactor:     loghttp.DefaultRedactor,
+//		MaxBodySize:  loghttp.DefaultMaxBodySize,
+//		ContentTypes: loghttp.DefaultDumpContentTypes,
+//	}
+var DefaultDumper = &Dumper{
+	Redactor: DefaultRedactor,
+}
+
+// redactRequest returns a shallow copy of r with redacted URL and header, if
+// a redaction is required.
+func (d *Dumper) redactRequest(r *http.Request) *http.Request {
+	h, hChanged := d.Redactor.header(r.Header)
+	u, uChanged := d.Redactor.url(r.URL)
+	if !hChanged && !uChanged {
+		return r
+	}
+	r2 := ShallowCloneRequest(r)
+	r2.Header = h
+	if uChanged {
+		r2.URL = u
+		if strings.HasPrefix(r.RequestURI, "http://") || strings.HasPrefix(r.RequestURI, "https://") {
+			r2.RequestURI = u.String()
+		} else if r.RequestURI != "" {
+			r2.RequestURI = u.RequestURI()
+		}
+	}
+	return r2
+}
+
+func (d *Dumper) dumpRequest(r *http.Request, dumpBody bool) ([]byte, error) {
+	b, err := httputil.DumpRequest(d.redactRequest(r), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "[log] AddTo.HTTPRequest.DumpRequest")
+	}
+	if !dumpBody {
+		return b, nil
+	}
+	b, r.Body, err = d.dumpBody(b, r.Header, r.Body, r.ContentLength)
+	return b, errors.Wrap(err, "[log] AddTo.HTTPRequest.DumpRequest")
+}
+
+// redactResponse returns a shallow copy of r with redacted header, if a
+// redaction is required.
+func (d *Dumper) redactResponse(r *http.Response) *http.Response {
+	h, changed := d.Redactor.header(r.Header)
+	if !changed {
+		return r
+	}
+	r2 := new(http.Response)
+	*r2 = *r
+	r2.Header = h
+	return r2
+}
+
+func (d *Dumper) dumpResponse(r *http.Response, dumpBody bool) ([]byte, error) {
+	b, err := httputil.DumpResponse(d.redactResponse(r), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "[log] AddTo.HTTPRequest.DumpResponse")
+	}
+	if !dumpBody {
+		return b, nil
+	}
+	b, r.Body, err = d.dumpBody(b, r.Header, r.Body, r.ContentLength)
+	return b, errors.Wrap(err, "[log] AddTo.HTTPRequest.DumpResponse")
+}
+
+func (d *Dumper) addToHTTPRequest(key string, r *http.Request, dumpBody bool) func(log.AddStringFn) error {
 	return func(addString log.AddStringFn) error {
-		b, err := httputil.DumpRequest(r, dumpBody)
+		b, err := d.dumpRequest(r, dumpBody)
 		if err != nil {
-			return errors.Wrap(err, "[log] AddTo.HTTPRequest.DumpRequest")
+			return errors.WithStack(err)
 		}
 		addString(key, string(b))
+		return nil
+	}
+}
 
+func (d *Dumper) addToHTTPResponse(key string, r *http.Response, dumpBody bool) func(log.AddStringFn) error {
+	return func(addString log.AddStringFn) error {
+		b, err := d.dumpResponse(r, dumpBody)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		addString(key, string(b))
 		return nil
 	}
 }
 
+// Request same as the package level function Request but uses the
+// configuration of the Dumper.
+func (d *Dumper) Request(key string, r *http.Request) log.Field {
+	return log.StringFn(key, d.addToHTTPRequest(key, r, true))
+}
+
+// RequestHeader same as the package level function RequestHeader but uses the
+// configuration of the Dumper.
+func (d *Dumper) RequestHeader(key string, shallowCopiedR *http.Request) log.Field {
+	return log.StringFn(key, d.addToHTTPRequest(key, shallowCopiedR, false))
+}
+
+// Response same as the package level function Response but uses the
+// configuration of the Dumper.
+func (d *Dumper) Response(key string, r *http.Response) log.Field {
+	return log.StringFn(key, d.addToHTTPResponse(key, r, true))
+}
+
+// ResponseHeader same as the package level function ResponseHeader but uses
+// the configuration of the Dumper.
+func (d *Dumper) ResponseHeader(key string, r *http.Response) log.Field {
+	return log.StringFn(key, d.addToHTTPResponse(key, r, false))
+}
+
 // ShallowCloneRequest convenient helper function to create a shallow clone of a
 // request object.
 func ShallowCloneRequest(r *http.Request) *http.Request {
@@ -44,7 +169,8 @@ func ShallowCloneRequest(r *http.Request) *http.Request {
 
 // Request transforms the request with the function httputil.DumpRequest(r,
 // true) into a string. The body gets logged also. Not completely race condition
-// free because it depends on the Body io.ReadCloser implementation.
+// free because it depends on the Body io.ReadCloser implementation. Secrets get
+// replaced by the DefaultDumper.
 //
 // DumpRequest returns the given request in its HTTP/1.x wire representation. It
 // should only be used by servers to debug client requests. The returned
@@ -54,40 +180,40 @@ func ShallowCloneRequest(r *http.Request) *http.Request {
 // headers is kept intact. HTTP/2 requests are dumped in HTTP/1.x form, not in
 // their original binary representations.
 //
-// `shallowCopiedR` must be a shallow copy of the original request object
-// otherwise you will see race condition when the different log levels are
-// enabled. You must find the correct spot where to clone the request object.
-func Request(key string, shallowCopiedR *http.Request) log.Field {
-	return log.StringFn(key, addToHTTPRequest(key, shallowCopiedR, true))
+// Pass the request which the handler reads, not a shallow copy of it. The
+// Body of `r` gets replaced with a reader which yields the full original
+// content, hence the handler can still read `r.Body` after logging. The
+// original body does not get closed. A shallow copy would receive the
+// replacement while the body of the original request stays consumed.
+func Request(key string, r *http.Request) log.Field {
+	return DefaultDumper.Request(key, r)
 }
 
 // RequestHeader transforms the request with the function
 // httputil.DumpRequest(r, false) into a string. The body gets not logged and
-// hence it is race condition free.
+// hence it is race condition free. Secrets get replaced by the DefaultDumper.
 //
 // `shallowCopiedR` must be a shallow copy of the original request object
 // otherwise you will see race condition when the different log levels are
 // enabled. You must find the correct spot where to clone the request object.
 func RequestHeader(key string, shallowCopiedR *http.Request) log.Field {
-	return log.StringFn(key, addToHTTPRequest(key, shallowCopiedR, false))
+	return DefaultDumper.RequestHeader(key, shallowCopiedR)
 }
 
 // todo: add http.DumpRequestOut() with header+body and header only
 
-// todo: add ResponseHeader()
-
 // Response transforms the response with the function
 // httputil.DumpResponse(r, true) into a string. Same behaviour as
 // HTTPRequest(). The body gets logged also. Not completely race condition free
-// because it depends on the Body io.ReadCloser implementation.
+// because it depends on the Body io.ReadCloser implementation. Secrets get
+// replaced by the DefaultDumper.
 func Response(key string, r *http.Response) log.Field {
-	return log.StringFn(key, func(addString log.AddStringFn) error {
-		b, err := httputil.DumpResponse(r, true)
-		if err != nil {
-			return errors.Wrap(err, "[log] AddTo.HTTPRequest.DumpResponse")
-		}
-		addString(key, string(b))
+	return DefaultDumper.Response(key, r)
+}
 
-		return nil
-	})
+// ResponseHeader transforms the response with the function
+// httputil.DumpResponse(r, false) into a string. The body gets not logged.
+// Secrets get replaced by the DefaultDumper.
+func ResponseHeader(key string, r *http.Response) log.Field {
+	return DefaultDumper.ResponseHeader(key, r)
 }
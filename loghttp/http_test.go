@@ -26,8 +26,8 @@ import (
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/log/logw"
 	"github.com/corestoreio/pkg/util/assert"
-	"github.com/tdewolff/parse/buffer"
 )
 
 const testKey = "MyTestKey"
@@ -75,8 +75,14 @@ func closerWithErr(err error, r io.Reader) io.ReadCloser {
 	return errCloser{error: err, Reader: r}
 }
 
+type errReader struct{ error }
+
+func (er errReader) Read([]byte) (int, error) { return 0, er.error }
+
+func (er errReader) Close() error { return nil }
+
 func TestField_Request_Error(t *testing.T) {
-	testR := httptest.NewRequest("GET", "/", closerWithErr(errors.New("XErr"), buffer.NewReader(nil)))
+	testR := httptest.NewRequest("GET", "/", errReader{errors.New("XErr")})
 
 	f := loghttp.Request(testKey, testR)
 
@@ -86,6 +92,45 @@ func TestField_Request_Error(t *testing.T) {
 	assert.EqualError(t, f.AddTo(wt), `[log] AddTo.StringFn: [log] AddTo.HTTPRequest.DumpRequest: XErr`)
 }
 
+func TestField_Request_BodyReadableByHandler(t *testing.T) {
+	const data = `35. “My universe is my eyes and my ears. Anything else is hearsay.” Douglas Adams`
+
+	buf := new(log.MutexBuffer)
+	l := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelDebug))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Debug("dump", loghttp.Request(testKey, r))
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL, "text/plain", strings.NewReader(data))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Exactly(t, data, string(b), "Handler must read the full body")
+	assert.Contains(t, buf.String(), "Douglas Adams")
+}
+
+func TestField_Request_NotClosed(t *testing.T) {
+	const data = `0123456789`
+
+	// Closing the body would return the error.
+	req := httptest.NewRequest("POST", "/", closerWithErr(errors.New("XErr"), strings.NewReader(data)))
+	buf := &bytes.Buffer{}
+	assert.NoError(t, loghttp.Request(testKey, req).AddTo(log.WriteTypes{W: buf}))
+	assert.Contains(t, buf.String(), data)
+
+	b, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Exactly(t, data, string(b))
+	assert.EqualError(t, req.Body.Close(), "XErr")
+}
+
 func TestField_Response(t *testing.T) {
 	const data = `35. “My universe is my eyes and my ears. Anything else is hearsay.” Douglas Adams`
 
@@ -124,7 +169,7 @@ func TestField_Response_Error(t *testing.T) {
 		Header: http.Header{
 			"X-CoreStore-ID": []string{"987654321"},
 		},
-		Body:          closerWithErr(errors.New("XErr"), buffer.NewReader(nil)),
+		Body:          errReader{errors.New("XErr")},
 		ContentLength: int64(len(data)),
 	}
 
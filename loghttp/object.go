@@ -0,0 +1,195 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corestoreio/log"
+)
+
+type requestObject struct {
+	d *Dumper
+	r *http.Request
+}
+
+type responseObject struct {
+	d *Dumper
+	r *http.Response
+}
+
+// RequestObject creates a nested field of the request without dumping it. The
+// keys follow the OpenTelemetry HTTP semantic conventions:
+//
+//	http.request.method, url.scheme, server.address, server.port, url.path,
+//	url.query.<name>, network.protocol.name, network.protocol.version,
+//	http.request.header.<lowercase name>, http.request.body.size,
+//	client.address, client.port, user_agent.original, tls.protocol.version,
+//	tls.cipher
+//
+// Multiple values of a header or query parameter get joined by ", ". Secrets
+// get replaced by the Redactor of the Dumper. The body does not get read.
+func (d *Dumper) RequestObject(key string, r *http.Request) log.Field {
+	return log.Marshal(key, requestObject{d: d, r: r})
+}
+
+// ResponseObject creates a nested field of the response without dumping it.
+// The keys follow the OpenTelemetry HTTP semantic conventions:
+//
+//	http.response.status_code, network.protocol.name,
+//	network.protocol.version, http.response.header.<lowercase name>,
+//	http.response.body.size, tls.protocol.version, tls.cipher
+//
+// Secrets get replaced by the Redactor of the Dumper. The body does not get
+// read.
+func (d *Dumper) ResponseObject(key string, r *http.Response) log.Field {
+	return log.Marshal(key, responseObject{d: d, r: r})
+}
+
+// RequestObject creates a nested field of the request with the DefaultDumper.
+// See Dumper.RequestObject.
+func RequestObject(key string, r *http.Request) log.Field {
+	return DefaultDumper.RequestObject(key, r)
+}
+
+// ResponseObject creates a nested field of the response with the
+// DefaultDumper. See Dumper.ResponseObject.
+func ResponseObject(key string, r *http.Response) log.Field {
+	return DefaultDumper.ResponseObject(key, r)
+}
+
+// MarshalLog implements log.Marshaler.
+func (ro requestObject) MarshalLog(kv log.KeyValuer) error {
+	r := ro.r
+	kv.AddString("http.request.method", r.Method)
+
+	u := r.URL
+	if u == nil {
+		u = new(url.URL)
+	}
+	u, _ = ro.d.Redactor.url(u)
+
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	kv.AddString("url.scheme", scheme)
+
+	host := r.Host
+	if host == "" {
+		host = u.Host
+	}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		kv.AddString("server.address", h)
+		if port, err := strconv.Atoi(p); err == nil {
+			kv.AddInt("server.port", port)
+		}
+	} else if host != "" {
+		kv.AddString("server.address", host)
+	}
+
+	kv.AddString("url.path", u.Path)
+	if u.RawQuery != "" {
+		addValues(kv, "url.query.", u.Query(), false)
+	}
+	addProto(kv, r.Proto)
+
+	h, _ := ro.d.Redactor.header(r.Header)
+	addValues(kv, "http.request.header.", url.Values(h), true)
+	if r.ContentLength > 0 {
+		kv.AddInt64("http.request.body.size", r.ContentLength)
+	}
+
+	if r.RemoteAddr != "" {
+		if h, p, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			kv.AddString("client.address", h)
+			if port, err := strconv.Atoi(p); err == nil {
+				kv.AddInt("client.port", port)
+			}
+		} else {
+			kv.AddString("client.address", r.RemoteAddr)
+		}
+	}
+	if ua := r.UserAgent(); ua != "" {
+		kv.AddString("user_agent.original", ua)
+	}
+	addTLS(kv, r.TLS)
+	return nil
+}
+
+// MarshalLog implements log.Marshaler.
+func (ro responseObject) MarshalLog(kv log.KeyValuer) error {
+	r := ro.r
+	kv.AddInt("http.response.status_code", r.StatusCode)
+	addProto(kv, r.Proto)
+	h, _ := ro.d.Redactor.header(r.Header)
+	addValues(kv, "http.response.header.", url.Values(h), true)
+	if r.ContentLength >= 0 {
+		kv.AddInt64("http.response.body.size", r.ContentLength)
+	}
+	addTLS(kv, r.TLS)
+	return nil
+}
+
+// addValues adds all values sorted by their name with the prefix. Multiple
+// values get joined by ", ".
+func addValues(kv log.KeyValuer, prefix string, vals map[string][]string, lowerCase bool) {
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k
+		if lowerCase {
+			name = strings.ToLower(k)
+		}
+		kv.AddString(prefix+name, strings.Join(vals[k], ", "))
+	}
+}
+
+func addProto(kv log.KeyValuer, proto string) {
+	name, version := proto, ""
+	if i := strings.IndexByte(proto, '/'); i > 0 {
+		name, version = proto[:i], proto[i+1:]
+	}
+	if name == "" {
+		return
+	}
+	kv.AddString("network.protocol.name", strings.ToLower(name))
+	if version == "2.0" || version == "3.0" {
+		version = version[:1]
+	}
+	if version != "" {
+		kv.AddString("network.protocol.version", version)
+	}
+}
+
+func addTLS(kv log.KeyValuer, cs *tls.ConnectionState) {
+	if cs == nil {
+		return
+	}
+	kv.AddString("tls.protocol.version", tlsVersionName(cs.Version))
+	kv.AddString("tls.cipher", tls.CipherSuiteName(cs.CipherSuite))
+}
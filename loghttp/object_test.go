@@ -0,0 +1,59 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestRequestObject(t *testing.T) {
+	req := httptest.NewRequest("PUT", "https://corestore.io:8443/catalog?id=1&id=2&token=abc", strings.NewReader(`{}`))
+	req.RemoteAddr = "203.0.113.7:50000"
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("User-Agent", "GopherBot")
+	req.TLS.Version = tls.VersionTLS13
+	req.TLS.CipherSuite = tls.TLS_AES_128_GCM_SHA256
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, loghttp.RequestObject(testKey, req).AddTo(log.WriteTypes{W: buf}))
+	assert.Exactly(t, ` http.request.method: "PUT" url.scheme: "https" server.address: "corestore.io" server.port: 8443`+
+		` url.path: "/catalog" url.query.id: "1, 2" url.query.token: "REDACTED" network.protocol.name: "http" network.protocol.version: "1.1"`+
+		` http.request.header.authorization: "REDACTED" http.request.header.user-agent: "GopherBot" http.request.body.size: 2`+
+		` client.address: "203.0.113.7" client.port: 50000 user_agent.original: "GopherBot"`+
+		` tls.protocol.version: "1.3" tls.cipher: "TLS_AES_128_GCM_SHA256"`, buf.String())
+}
+
+func TestResponseObject(t *testing.T) {
+	res := &http.Response{
+		StatusCode:    http.StatusTeapot,
+		Proto:         "HTTP/2.0",
+		Header:        http.Header{"Set-Cookie": []string{"a=b"}, "Content-Type": []string{"text/plain"}},
+		ContentLength: 0,
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, loghttp.ResponseObject(testKey, res).AddTo(log.WriteTypes{W: buf}))
+	assert.Exactly(t, ` http.response.status_code: 418 network.protocol.name: "http" network.protocol.version: "2"`+
+		` http.response.header.content-type: "text/plain" http.response.header.set-cookie: "REDACTED" http.response.body.size: 0`, buf.String())
+}
@@ -0,0 +1,139 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/corestoreio/log"
+)
+
+type recoverer struct {
+	msg          string
+	handler      http.Handler
+	dumper       *Dumper
+	repanicAbort bool
+}
+
+// RecoverOption can be used as an argument in Recover to configure the
+// middleware.
+type RecoverOption func(*recoverer)
+
+// WithRecoverMessage sets the message of the crash report. Defaults to
+// "[loghttp] panic recovered".
+func WithRecoverMessage(msg string) RecoverOption {
+	return func(rc *recoverer) {
+		rc.msg = msg
+	}
+}
+
+// WithRecoverHandler sets the handler which writes the response after a
+// panic. The default handler writes a 500 Internal Server Error. The handler
+// does not get called if the response header has already been written.
+func WithRecoverHandler(h http.Handler) RecoverOption {
+	return func(rc *recoverer) {
+		rc.handler = h
+	}
+}
+
+// WithRecoverDumper sets the Dumper which creates the redacted request field.
+// Defaults to DefaultDumper.
+func WithRecoverDumper(d *Dumper) RecoverOption {
+	return func(rc *recoverer) {
+		rc.dumper = d
+	}
+}
+
+// WithRecoverRepanicAbort defines whether http.ErrAbortHandler gets
+// re-panicked after it has been logged, so the http.Server aborts the
+// response. Defaults to true.
+func WithRecoverRepanicAbort(repanic bool) RecoverOption {
+	return func(rc *recoverer) {
+		rc.repanicAbort = repanic
+	}
+}
+
+// Recover returns a middleware which recovers panics of the next handler and
+// logs a crash report with Info level. The report contains the panic value,
+// the stack of the panicking goroutine, the request ID and the redacted
+// request created by Dumper.RequestObject. If the context contains a logger,
+// see NewContext, that logger gets used instead of l. The request ID gets
+// added unless that logger has been created by the RequestID middleware.
+func Recover(l log.Logger, opts ...RecoverOption) func(http.Handler) http.Handler {
+	rc := &recoverer{
+		msg: "[loghttp] panic recovered",
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}),
+		dumper:       DefaultDumper,
+		repanicAbort: true,
+	}
+	for _, o := range opts {
+		o(rc)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := newResponseWriter(w)
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				rc.log(l, r, rec, debug.Stack())
+				if rec == http.ErrAbortHandler && rc.repanicAbort {
+					panic(rec)
+				}
+				if rw.status == 0 {
+					rc.handler.ServeHTTP(rw, r)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func (rc *recoverer) log(l log.Logger, r *http.Request, rec interface{}, stack []byte) {
+	if ctxLog, ok := FromContext(r.Context()); ok {
+		l = ctxLog
+	}
+	if !l.IsInfo() {
+		return
+	}
+	var panicField log.Field
+	if err, ok := rec.(error); ok {
+		panicField = log.ErrWithKey("panic", err)
+	} else {
+		panicField = log.String("panic", fmt.Sprint(rec))
+	}
+	fields := log.Fields{
+		panicField,
+		log.String("stack", string(stack)),
+		rc.dumper.RequestObject("request", r),
+	}
+	// The loggers of the RequestID and DebugLog middlewares contain already
+	// the request ID.
+	if !loggerWithRequestID(r.Context()) {
+		id := RequestIDFromContext(r.Context())
+		if hid := r.Header.Get(HeaderRequestID); id == "" && validRequestID(hid) {
+			id = hid
+		}
+		if id != "" {
+			fields = append(fields, log.String(KeyNameRequestID, id))
+		}
+	}
+	l.Info(rc.msg, fields...)
+}
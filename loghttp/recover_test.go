@@ -0,0 +1,141 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestRecover(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	h := loghttp.RequestID(lg)(
+		loghttp.Recover(lg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})))
+
+	req := httptest.NewRequest("GET", "/crash?token=secret", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(loghttp.HeaderRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Exactly(t, http.StatusInternalServerError, rec.Code)
+	assert.Exactly(t, "Internal Server Error\n", rec.Body.String())
+
+	out := buf.String()
+	assert.Contains(t, out, `INFO [loghttp] panic recovered request_id: "req-1" panic: "boom" stack: "goroutine `)
+	assert.Exactly(t, 1, strings.Count(out, `request_id`))
+	assert.Contains(t, out, `recover_test.go`)
+	assert.Contains(t, out, `http.request.method: "GET"`)
+	assert.Contains(t, out, `url.path: "/crash"`)
+	assert.Contains(t, out, `url.query.token: "REDACTED"`)
+	assert.Contains(t, out, `http.request.header.authorization: "REDACTED"`)
+	assert.NotContains(t, out, "secret")
+}
+
+func TestRecover_ContextLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	withUser := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := loghttp.NewContext(r.Context(), lg.With(log.String("user", "alice")))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	h := loghttp.RequestID(lg)(withUser(
+		loghttp.Recover(lg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(loghttp.HeaderRequestID, "req-2")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	assert.Contains(t, out, `INFO [loghttp] panic recovered user: "alice" panic: "boom" `)
+	assert.Contains(t, out, ` request_id: "req-2"`)
+	assert.Exactly(t, 1, strings.Count(out, `request_id`))
+}
+
+func TestRecover_Options(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	h := loghttp.Recover(lg,
+		loghttp.WithRecoverMessage("crash"),
+		loghttp.WithRecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"internal"}`))
+		})),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("failed"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(loghttp.HeaderRequestID, "evil\nid")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Exactly(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Exactly(t, `{"error":"internal"}`, rec.Body.String())
+	assert.Contains(t, buf.String(), `INFO crash panic: "failed" stack: `)
+	assert.NotContains(t, buf.String(), "request_id")
+}
+
+func TestRecover_HeaderWritten(t *testing.T) {
+	h := loghttp.Recover(logw.NewLog(logw.WithWriter(new(bytes.Buffer))))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Exactly(t, http.StatusAccepted, rec.Code)
+	assert.Exactly(t, "partial", rec.Body.String())
+}
+
+func TestRecover_ErrAbortHandler(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+	abort := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	rec := httptest.NewRecorder()
+	loghttp.Recover(lg, loghttp.WithRecoverRepanicAbort(false))(abort).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Exactly(t, http.StatusInternalServerError, rec.Code)
+
+	func() {
+		defer func() {
+			assert.Exactly(t, http.ErrAbortHandler, recover())
+		}()
+		loghttp.Recover(lg)(abort).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		t.Error("Expected a panic by default")
+	}()
+	assert.Contains(t, buf.String(), `panic: "net/http: abort Handler"`)
+}
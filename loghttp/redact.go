@@ -0,0 +1,484 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// redacted replaces secret values in the log stream.
+const redacted = `REDACTED`
+
+// Redactor defines a policy which secrets get replaced in dumped requests and
+// responses. All name comparisons are case-insensitive. A nil Redactor
+// disables redaction.
+type Redactor struct {
+	// Headers contains the names of request and response headers whose
+	// values get replaced.
+	Headers []string
+	// Query contains the names of URL query parameters whose values get
+	// replaced. The password of the URL user info gets always replaced.
+	Query []string
+	// Form contains the names of form fields whose values get replaced in
+	// bodies of the type application/x-www-form-urlencoded.
+	Form []string
+	// JSON contains paths into JSON bodies whose values get replaced. A path
+	// without a dot matches the key at any depth. A path with dots, e.g.
+	// "card.number", gets matched from the root and a "*" matches any key or
+	// array index. JSON bodies get re-encoded, hence formatting and key order
+	// change. Truncated bodies get redacted field by field and keep their
+	// formatting. Bodies with syntax errors get replaced completely.
+	JSON []string
+	// Replacement defines the replacement of secret values. Defaults to
+	// "REDACTED".
+	Replacement string
+}
+
+// DefaultRedactor defines the redaction policy used by the package level
+// functions Request, RequestHeader, Response and by Transport. It can be
+// changed globally but not concurrently with logging.
+var DefaultRedactor = &Redactor{
+	Headers: []string{
+		"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie",
+		"X-Api-Key", "X-Auth-Token", "X-Csrf-Token", "X-Xsrf-Token",
+	},
+	Query: []string{
+		"access_token", "api_key", "apikey", "auth", "client_secret", "code",
+		"key", "password", "secret", "sig", "signature", "token",
+	},
+	Form: []string{
+		"card_number", "client_secret", "credit_card", "cvc", "cvv", "pass",
+		"passwd", "password", "password_confirmation", "secret", "token",
+	},
+	JSON: []string{
+		"access_token", "card_number", "client_secret", "cvc", "cvv",
+		"password", "refresh_token", "secret", "token",
+	},
+}
+
+func (rd *Redactor) replacement() string {
+	if rd.Replacement == "" {
+		return redacted
+	}
+	return rd.Replacement
+}
+
+func matchName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns a copy of h with the values of all secret headers replaced.
+// If nothing has to be replaced, h gets returned.
+func (rd *Redactor) Header(h http.Header) http.Header {
+	h2, _ := rd.header(h)
+	return h2
+}
+
+func (rd *Redactor) header(h http.Header) (http.Header, bool) {
+	if rd == nil {
+		return h, false
+	}
+	var h2 http.Header
+	for k, vals := range h {
+		if !matchName(rd.Headers, k) {
+			continue
+		}
+		if h2 == nil {
+			h2 = h.Clone()
+		}
+		rv := make([]string, len(vals))
+		for i := range rv {
+			rv[i] = rd.replacement()
+		}
+		h2[k] = rv
+	}
+	if h2 == nil {
+		return h, false
+	}
+	return h2, true
+}
+
+// headerValue returns the first value of the header name, or the replacement
+// if the header is secret and set.
+func (rd *Redactor) headerValue(h http.Header, name string) string {
+	v := h.Get(name)
+	if rd == nil || v == "" || !matchName(rd.Headers, name) {
+		return v
+	}
+	return rd.replacement()
+}
+
+// URL returns a copy of u with the password of the user info and the values
+// of all secret query parameters replaced. If nothing has to be replaced, u
+// gets returned.
+func (rd *Redactor) URL(u *url.URL) *url.URL {
+	u2, _ := rd.url(u)
+	return u2
+}
+
+func (rd *Redactor) url(u *url.URL) (*url.URL, bool) {
+	if rd == nil || u == nil {
+		return u, false
+	}
+	u2 := *u
+	var changed bool
+	if u.User != nil {
+		if _, has := u.User.Password(); has {
+			u2.User = url.UserPassword(u.User.Username(), rd.replacement())
+			changed = true
+		}
+	}
+	if u.RawQuery != "" && len(rd.Query) > 0 {
+		q := u.Query()
+		var qChanged bool
+		for k, vals := range q {
+			if matchName(rd.Query, k) {
+				for i := range vals {
+					vals[i] = rd.replacement()
+				}
+				qChanged = true
+			}
+		}
+		if qChanged {
+			u2.RawQuery = q.Encode()
+			changed = true
+		}
+	}
+	if !changed {
+		return u, false
+	}
+	return &u2, true
+}
+
+// Body returns the body with all secret form fields or JSON values replaced,
+// depending on the media type of contentType. An empty contentType, i.e. a
+// body without a Content-Type header, gets redacted as a form if it contains a
+// secret form field and otherwise as JSON if it starts like JSON. Other media
+// types get returned unchanged.
+func (rd *Redactor) Body(contentType string, body []byte) []byte {
+	if rd == nil || len(body) == 0 {
+		return body
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mt == "application/x-www-form-urlencoded" && len(rd.Form) > 0:
+		b, _, err := rd.form(body)
+		if err != nil {
+			return []byte(rd.replacement())
+		}
+		return b
+	case (mt == "application/json" || strings.HasSuffix(mt, "+json")) && len(rd.JSON) > 0:
+		return rd.json(body)
+	case contentType == "":
+		return rd.untyped(body)
+	}
+	return body
+}
+
+// untyped redacts a body of an unknown media type by its secret keys, first
+// as a form and then as JSON.
+func (rd *Redactor) untyped(body []byte) []byte {
+	if len(rd.Form) > 0 {
+		if b, changed, err := rd.form(body); err == nil && changed {
+			return b
+		}
+	}
+	if t := bytes.TrimSpace(body); len(rd.JSON) > 0 && len(t) > 0 && (t[0] == '{' || t[0] == '[') {
+		return rd.json(body)
+	}
+	return body
+}
+
+func (rd *Redactor) form(body []byte) (_ []byte, changed bool, _ error) {
+	q, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, false, err
+	}
+	for k, vals := range q {
+		if matchName(rd.Form, k) {
+			for i := range vals {
+				vals[i] = rd.replacement()
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return body, false, nil
+	}
+	return []byte(q.Encode()), true, nil
+}
+
+func (rd *Redactor) json(body []byte) []byte {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		if b, ok := rd.jsonTruncated(body); ok {
+			return b
+		}
+		return []byte(rd.replacement())
+	}
+	var changed bool
+	for _, p := range rd.JSON {
+		if !strings.Contains(p, ".") {
+			changed = rd.jsonKeyAnyDepth(v, p) || changed
+			continue
+		}
+		changed = rd.jsonPath(v, strings.Split(p, ".")) || changed
+	}
+	if !changed {
+		return body
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return []byte(rd.replacement())
+	}
+	return b
+}
+
+func (rd *Redactor) jsonKeyAnyDepth(v interface{}, key string) (changed bool) {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for k, val := range vt {
+			if strings.EqualFold(k, key) {
+				vt[k] = rd.replacement()
+				changed = true
+				continue
+			}
+			changed = rd.jsonKeyAnyDepth(val, key) || changed
+		}
+	case []interface{}:
+		for _, val := range vt {
+			changed = rd.jsonKeyAnyDepth(val, key) || changed
+		}
+	}
+	return changed
+}
+
+func (rd *Redactor) jsonPath(v interface{}, path []string) (changed bool) {
+	if len(path) == 0 {
+		return false
+	}
+	seg, last := path[0], len(path) == 1
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for k, val := range vt {
+			if seg != "*" && !strings.EqualFold(k, seg) {
+				continue
+			}
+			if last {
+				vt[k] = rd.replacement()
+				changed = true
+				continue
+			}
+			changed = rd.jsonPath(val, path[1:]) || changed
+		}
+	case []interface{}:
+		for i, val := range vt {
+			if seg != "*" && seg != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				vt[i] = rd.replacement()
+				changed = true
+				continue
+			}
+			changed = rd.jsonPath(val, path[1:]) || changed
+		}
+	}
+	return changed
+}
+
+// jsonFrame is an object or array in which jsonTruncated currently scans.
+type jsonFrame struct {
+	object  bool
+	key     string // current key of an object
+	index   int    // current index of an array
+	wantKey bool   // an object expects a key or its end
+}
+
+// jsonTruncated redacts a JSON document which ends prematurely, e.g. because
+// the dump has been truncated, field by field. The secret values get replaced
+// within the original bytes. ok is false if the document contains a syntax
+// error.
+func (rd *Redactor) jsonTruncated(body []byte) (_ []byte, ok bool) {
+	out := make([]byte, 0, len(body))
+	var stack []jsonFrame
+	i := 0
+	for i < len(body) {
+		c := body[i]
+		switch c {
+		case ' ', '\t', '\r', '\n', ':':
+			out = append(out, c)
+			i++
+			continue
+		case ',':
+			if len(stack) == 0 {
+				return nil, false
+			}
+			top := &stack[len(stack)-1]
+			if top.object {
+				top.wantKey = true
+			} else {
+				top.index++
+			}
+			out = append(out, c)
+			i++
+			continue
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1].object != (c == '}') {
+				return nil, false
+			}
+			stack = stack[:len(stack)-1]
+			out = append(out, c)
+			i++
+			continue
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].wantKey {
+			if c != '"' {
+				return nil, false
+			}
+			end := jsonValueEnd(body, i)
+			var key string
+			if err := json.Unmarshal(body[i:end], &key); err != nil {
+				key = string(body[i+1 : end])
+			}
+			stack[n-1].key = key
+			stack[n-1].wantKey = false
+			out = append(out, body[i:end]...)
+			i = end
+			continue
+		}
+
+		if rd.matchJSONPath(stack) {
+			out = append(out, strconv.Quote(rd.replacement())...)
+			i = jsonValueEnd(body, i)
+			continue
+		}
+		switch c {
+		case '{':
+			stack = append(stack, jsonFrame{object: true, wantKey: true})
+			out = append(out, c)
+			i++
+		case '[':
+			stack = append(stack, jsonFrame{})
+			out = append(out, c)
+			i++
+		default:
+			end := jsonValueEnd(body, i)
+			out = append(out, body[i:end]...)
+			i = end
+		}
+	}
+	return out, true
+}
+
+// jsonValueEnd returns the offset after the value which starts at i, or the
+// length of body if the value has been truncated.
+func jsonValueEnd(body []byte, i int) int {
+	depth := 0
+	inString := false
+	for j := i; j < len(body); j++ {
+		c := body[j]
+		switch {
+		case inString:
+			switch c {
+			case '\\':
+				j++
+			case '"':
+				inString = false
+				if depth == 0 {
+					return j + 1
+				}
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth == 0 {
+				return j
+			}
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		case depth == 0 && (c == ',' || c == ':' || c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			return j
+		}
+	}
+	return len(body)
+}
+
+// matchJSONPath reports whether the value at the current position of the
+// stack matches one of the JSON paths.
+func (rd *Redactor) matchJSONPath(stack []jsonFrame) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	top := stack[len(stack)-1]
+	for _, p := range rd.JSON {
+		if !strings.Contains(p, ".") {
+			if top.object && strings.EqualFold(top.key, p) {
+				return true
+			}
+			continue
+		}
+		path := strings.Split(p, ".")
+		if len(path) != len(stack) {
+			continue
+		}
+		match := true
+		for i, f := range stack {
+			seg := path[i]
+			switch {
+			case seg == "*":
+			case f.object && strings.EqualFold(f.key, seg):
+			case !f.object && seg == strconv.Itoa(f.index):
+			default:
+				match = false
+			}
+			if !match {
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL returns the URL as a string with the password of the user info
+// and the values of the query parameters `keys` replaced. The comparison of
+// the keys is case-insensitive.
+func RedactURL(u *url.URL, keys ...string) string {
+	if u == nil {
+		return ""
+	}
+	return (&Redactor{Query: keys}).URL(u).String()
+}
@@ -0,0 +1,121 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestField_Request_Redacted(t *testing.T) {
+	const data = `user=gopher&password=s3cr3t`
+
+	req := httptest.NewRequest("POST", "/login?token=abc&page=2", strings.NewReader(data))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("Cookie", "session=xyz")
+
+	buf := &bytes.Buffer{}
+	if err := loghttp.Request(testKey, req).AddTo(log.WriteTypes{W: buf}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Exactly(t, " MyTestKey: \"POST /login?page=2&token=REDACTED HTTP/1.1\\r\\nHost: example.com\\r\\nAuthorization: REDACTED\\r\\nContent-Type: application/x-www-form-urlencoded\\r\\nCookie: REDACTED\\r\\n\\r\\npassword=REDACTED&user=gopher\"", buf.String())
+
+	body, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Exactly(t, data, string(body), "Request body must not be redacted")
+	assert.Exactly(t, "Bearer abc", req.Header.Get("Authorization"), "Request header must not be redacted")
+}
+
+func TestField_Response_Redacted(t *testing.T) {
+	const data = `{"user":{"name":"gopher","password":"s3cr3t"},"cards":[{"number":"4111","cvv":123}]}`
+
+	res := &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type": []string{"application/json; charset=utf-8"},
+			"Set-Cookie":   []string{"session=xyz"},
+		},
+		Body:          ioutil.NopCloser(strings.NewReader(data)),
+		ContentLength: int64(len(data)),
+	}
+
+	d := &loghttp.Dumper{Redactor: &loghttp.Redactor{
+		Headers:     []string{"set-cookie"},
+		JSON:        []string{"password", "cards.*.number"},
+		Replacement: "***",
+	}}
+	buf := &bytes.Buffer{}
+	if err := d.Response(testKey, res).AddTo(log.WriteTypes{W: buf}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Exactly(t, " MyTestKey: \"HTTP/1.1 200 OK\\r\\nContent-Length: 84\\r\\nContent-Type: application/json; charset=utf-8\\r\\nSet-Cookie: ***\\r\\n\\r\\n{\\\"cards\\\":[{\\\"cvv\\\":123,\\\"number\\\":\\\"***\\\"}],\\\"user\\\":{\\\"name\\\":\\\"gopher\\\",\\\"password\\\":\\\"***\\\"}}\"", buf.String())
+
+	buf.Reset()
+	if err := loghttp.ResponseHeader(testKey, res).AddTo(log.WriteTypes{W: buf}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), `Set-Cookie: REDACTED`)
+	assert.NotContains(t, buf.String(), `password`)
+}
+
+func TestRedactor_Body(t *testing.T) {
+	rd := loghttp.DefaultRedactor
+	assert.Exactly(t, "REDACTED", string(rd.Body("application/json", []byte(`{"a" 1]`))), "Invalid JSON must be replaced")
+	assert.Exactly(t, `{"a":1}`, string(rd.Body("application/json", []byte(`{"a":1}`))))
+	assert.Exactly(t, `password=s3cr3t`, string(rd.Body("text/plain", []byte(`password=s3cr3t`))))
+
+	// Bodies without a Content-Type get redacted by their keys.
+	assert.Exactly(t, `name=bob&password=REDACTED`, string(rd.Body("", []byte(`password=s3cr3t&name=bob`))))
+	assert.Exactly(t, `[{"token":"REDACTED"}]`, string(rd.Body("", []byte(` [{"token":"s3cr3t"}]`))))
+	assert.Exactly(t, `name=bob`, string(rd.Body("", []byte(`name=bob`))))
+	assert.Exactly(t, `hello {"token":1}`, string(rd.Body("", []byte(`hello {"token":1}`))))
+
+	var nilRD *loghttp.Redactor
+	assert.Exactly(t, `password=s3cr3t`, string(nilRD.Body("application/x-www-form-urlencoded", []byte(`password=s3cr3t`))))
+}
+
+func TestRedactor_Body_TruncatedJSON(t *testing.T) {
+	rd := loghttp.DefaultRedactor
+	tests := []struct {
+		body, want string
+	}{
+		{`{"password":`, `{"password":`},
+		{`{"password":"s3cr`, `{"password":"REDACTED"`},
+		{`{"user":"bob", "password": "s3cr3t", "items": [1, 2], "cvv": 12`, `{"user":"bob", "password": "REDACTED", "items": [1, 2], "cvv": "REDACTED"`},
+		{`{"a":[{"token":{"x":[1,"}"]},"b":"c"},{"token":"x`, `{"a":[{"token":"REDACTED","b":"c"},{"token":"REDACTED"`},
+		{`{"pass\u0077ord":"x","note":"say \"password\": 1`, `{"pass\u0077ord":"REDACTED","note":"say \"password\": 1`},
+	}
+	for _, test := range tests {
+		assert.Exactly(t, test.want, string(rd.Body("application/json", []byte(test.body))), test.body)
+	}
+
+	rd = &loghttp.Redactor{JSON: []string{"card.number", "items.*.secret"}}
+	assert.Exactly(t,
+		`{"number":1,"card":{"number":"REDACTED","cvc":1},"items":[{"secret":"REDACTED"},{"secret":"REDACTED"`,
+		string(rd.Body("application/json", []byte(`{"number":1,"card":{"number":4111,"cvc":1},"items":[{"secret":"a"},{"secret":"b`))))
+}
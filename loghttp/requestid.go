@@ -0,0 +1,194 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/corestoreio/log"
+)
+
+type ctxKey uint8
+
+const (
+	ctxKeyLogger ctxKey = iota + 1
+	ctxKeyRequestID
+)
+
+// NewContext returns a copy of ctx which carries the logger.
+func NewContext(ctx context.Context, l log.Logger) context.Context {
+	return newContext(ctx, l, false)
+}
+
+// ctxLogger gets stored in the context. withID reports whether the logger
+// already adds the request ID to each entry.
+type ctxLogger struct {
+	l      log.Logger
+	withID bool
+}
+
+func newContext(ctx context.Context, l log.Logger, withID bool) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger, ctxLogger{l: l, withID: withID})
+}
+
+// FromContext returns the logger stored in ctx by NewContext or by the
+// RequestID middleware.
+func FromContext(ctx context.Context) (log.Logger, bool) {
+	cl, ok := ctx.Value(ctxKeyLogger).(ctxLogger)
+	return cl.l, ok
+}
+
+// loggerWithRequestID reports whether the logger in ctx adds the request ID.
+func loggerWithRequestID(ctx context.Context) bool {
+	cl, _ := ctx.Value(ctxKeyLogger).(ctxLogger)
+	return cl.withID
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by the RequestID
+// middleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// NewUUID returns a random version 4 UUID in its canonical string form.
+func NewUUID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant RFC 4122
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// NewULID returns a ULID with the current time from log.Now and 80 random
+// bits, encoded as 26 characters of Crockford's base32. ULIDs sort
+// lexicographically by their creation time.
+func NewULID() string {
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	var u [16]byte
+	ms := uint64(log.Now().UnixNano() / 1e6)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(u[:6], ts[2:])
+	_, _ = rand.Read(u[6:])
+
+	// 128 bits get encoded into 26 characters of 5 bits, the first character
+	// only holds 3 bits.
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		buf[i] = alphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+// validRequestID reports whether an incoming request ID can be used without
+// the risk of log injection.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '/' || c == '+' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type requestID struct {
+	header    string
+	generate  func() string
+	trustInID bool
+}
+
+// RequestIDOption can be used as an argument in RequestID to configure the
+// middleware.
+type RequestIDOption func(*requestID)
+
+// WithRequestIDHeader sets the name of the header which transports the request
+// ID. Defaults to HeaderRequestID.
+func WithRequestIDHeader(name string) RequestIDOption {
+	return func(ri *requestID) {
+		ri.header = name
+	}
+}
+
+// WithRequestIDGenerator sets the function which generates new request IDs.
+// Defaults to NewULID.
+func WithRequestIDGenerator(fn func() string) RequestIDOption {
+	return func(ri *requestID) {
+		ri.generate = fn
+	}
+}
+
+// WithRequestIDTrustIncoming defines whether a request ID sent by the client
+// gets used. Defaults to true. Incoming IDs which are longer than 128
+// characters or contain characters other than letters, digits and -_.:/+=
+// get always replaced.
+func WithRequestIDTrustIncoming(trust bool) RequestIDOption {
+	return func(ri *requestID) {
+		ri.trustInID = trust
+	}
+}
+
+// RequestID returns a middleware which reads the request ID from the request
+// header or generates a new one. The ID gets set on the response header and
+// stored in the request context together with a child logger
+// l.With(log.String(KeyNameRequestID, id)). Use FromContext and
+// RequestIDFromContext to retrieve them.
+func RequestID(l log.Logger, opts ...RequestIDOption) func(http.Handler) http.Handler {
+	ri := &requestID{
+		header:    HeaderRequestID,
+		generate:  NewULID,
+		trustInID: true,
+	}
+	for _, o := range opts {
+		o(ri)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(ri.header)
+			if !ri.trustInID || !validRequestID(id) {
+				id = ri.generate()
+			}
+			w.Header().Set(ri.header, id)
+
+			ctx := context.WithValue(r.Context(), ctxKeyRequestID, id)
+			ctx = newContext(ctx, l.With(log.String(KeyNameRequestID, id)), true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
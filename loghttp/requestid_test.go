@@ -0,0 +1,74 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lg := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+
+	var ids []string
+	h := loghttp.AccessLog(lg)(loghttp.RequestID(lg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, ok := loghttp.FromContext(r.Context())
+		assert.True(t, ok, "Logger must be in context")
+		id := loghttp.RequestIDFromContext(r.Context())
+		ids = append(ids, id)
+		l.Info("handler")
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Regexp(t, `^[0-9A-HJKMNP-TV-Z]{26}$`, ids[0])
+	assert.Exactly(t, ids[0], rec.Header().Get(loghttp.HeaderRequestID))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(loghttp.HeaderRequestID, "client-id-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Exactly(t, "client-id-1", ids[1])
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(loghttp.HeaderRequestID, "evil\nid")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, ids[2] != "evil\nid", "Invalid incoming ID must be replaced")
+
+	assert.Contains(t, buf.String(), "INFO handler request_id: \""+ids[0]+"\"\n")
+	assert.Contains(t, buf.String(), "INFO handler request_id: \"client-id-1\"\n")
+	assert.Exactly(t, 3, len(regexp.MustCompile(`access .+ request_id: "[^"]+"\n`).FindAllString(buf.String(), -1)))
+}
+
+func TestRequestID_Options(t *testing.T) {
+	h := loghttp.RequestID(logw.NewLog(),
+		loghttp.WithRequestIDHeader("X-Trace"),
+		loghttp.WithRequestIDGenerator(loghttp.NewUUID),
+		loghttp.WithRequestIDTrustIncoming(false),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Trace", "client-id-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, rec.Header().Get("X-Trace"))
+}
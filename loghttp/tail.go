@@ -0,0 +1,412 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// Levels of a TailEntry.
+const (
+	TailLevelDebug = "debug"
+	TailLevelInfo  = "info"
+)
+
+// TailEntry represents a log entry recorded by Tail.
+type TailEntry struct {
+	ID      uint64                 `json:"id"`
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"msg"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+type tailState struct {
+	mu        sync.Mutex
+	entries   []TailEntry // ring buffer
+	next      int
+	full      bool
+	lastID    uint64
+	subs      map[*tailSub]struct{}
+	debug     bool
+	chanSize  int
+	keepAlive time.Duration
+}
+
+// Tail records log entries in a ring buffer and streams them to HTTP clients
+// via Server-Sent Events. Tail implements log.Logger and http.Handler; a
+// typical setup mounts it on "/debug/logs" of an internal admin port. Loggers
+// created by With share the buffer. Tail is safe for concurrent use.
+//
+// Tail does not build on log.Recorder although both keep the last entries.
+// The Recorder stores pre-encoded text, bounded by entries or bytes, to dump
+// it cheaply. Tail keeps the field values to filter them and to encode them as
+// JSON, numbers the entries for the Last-Event-ID header and hands each entry
+// to the subscribed clients under the same lock which appends it.
+type Tail struct {
+	s *tailState
+	// ctx contains the captured fields of With, see log.Capture.
+	ctx log.Fields
+}
+
+// TailOption can be used as an argument in NewTail to configure the Tail.
+type TailOption func(*tailState)
+
+// WithTailDebug defines whether Debug entries get recorded. Defaults to true.
+func WithTailDebug(debug bool) TailOption {
+	return func(s *tailState) {
+		s.debug = debug
+	}
+}
+
+// WithTailClientBuffer sets the amount of events buffered per client. Events
+// get dropped for clients which cannot keep up. Defaults to 256.
+func WithTailClientBuffer(size int) TailOption {
+	return func(s *tailState) {
+		s.chanSize = size
+	}
+}
+
+// WithTailKeepAlive sets the interval of comment lines which keep idle
+// connections open. Zero disables them. Defaults to 15s.
+func WithTailKeepAlive(d time.Duration) TailOption {
+	return func(s *tailState) {
+		s.keepAlive = d
+	}
+}
+
+// NewTail creates a new Tail which keeps the last size entries.
+func NewTail(size int, opts ...TailOption) *Tail {
+	if size < 1 {
+		size = 1
+	}
+	s := &tailState{
+		entries:   make([]TailEntry, size),
+		subs:      make(map[*tailSub]struct{}),
+		debug:     true,
+		chanSize:  256,
+		keepAlive: 15 * time.Second,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return &Tail{s: s}
+}
+
+// With returns a new Logger that has this logger's context plus the given
+// Fields. The fields get evaluated once. The new Logger shares the buffer.
+func (t *Tail) With(fields ...log.Field) log.Logger {
+	t2 := new(Tail)
+	*t2 = *t
+	captured, _ := log.Capture(fields...)
+	t2.ctx = append(t2.ctx[:len(t2.ctx):len(t2.ctx)], captured...)
+	return t2
+}
+
+// Debug records a debug entry.
+func (t *Tail) Debug(msg string, fields ...log.Field) {
+	if t.s.debug {
+		t.record(TailLevelDebug, msg, fields)
+	}
+}
+
+// Info records an info entry.
+func (t *Tail) Info(msg string, fields ...log.Field) {
+	t.record(TailLevelInfo, msg, fields)
+}
+
+// IsDebug returns true if Debug entries get recorded.
+func (t *Tail) IsDebug() bool {
+	return t.s.debug
+}
+
+// IsInfo returns always true.
+func (t *Tail) IsInfo() bool {
+	return true
+}
+
+func (t *Tail) record(level, msg string, fields log.Fields) {
+	e := TailEntry{
+		Time:    log.Now(),
+		Level:   level,
+		Message: msg,
+	}
+	if len(t.ctx)+len(fields) > 0 {
+		tf := tailFields{m: make(map[string]interface{}, len(t.ctx)+len(fields))}
+		if err := t.ctx.AddTo(tf); err != nil {
+			tf.AddString(log.KeyNameError, fmt.Sprintf("%+v", err))
+		}
+		if err := fields.AddTo(tf); err != nil {
+			tf.AddString(log.KeyNameError, fmt.Sprintf("%+v", err))
+		}
+		e.Fields = tf.m
+	}
+
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	e.ID = s.lastID
+	s.entries[s.next] = e
+	s.next++
+	if s.next == len(s.entries) {
+		s.next = 0
+		s.full = true
+	}
+	for sub := range s.subs {
+		sub.send(e)
+	}
+}
+
+// Entries returns a copy of the recorded entries, oldest first.
+func (t *Tail) Entries() []TailEntry {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	return t.s.snapshot()
+}
+
+func (s *tailState) snapshot() []TailEntry {
+	if !s.full {
+		return append([]TailEntry(nil), s.entries[:s.next]...)
+	}
+	es := make([]TailEntry, 0, len(s.entries))
+	es = append(es, s.entries[s.next:]...)
+	return append(es, s.entries[:s.next]...)
+}
+
+// TailFilter selects the entries sent to a client.
+type TailFilter struct {
+	// Level defines the minimum level. Empty means TailLevelDebug.
+	Level string
+	// Message must be contained in the message of the entry.
+	Message string
+	// Fields contains key=value pairs which must all match a field of the
+	// entry. Values get compared in their fmt.Sprint representation.
+	Fields map[string]string
+}
+
+// ParseTailFilter creates a filter from the query parameters "level", "q" and
+// the repeatable "field=key=value".
+func ParseTailFilter(q map[string][]string) (TailFilter, error) {
+	get := func(k string) string {
+		if vs := q[k]; len(vs) > 0 {
+			return vs[0]
+		}
+		return ""
+	}
+	f := TailFilter{
+		Level:   get("level"),
+		Message: get("q"),
+	}
+	switch f.Level {
+	case "", TailLevelDebug, TailLevelInfo:
+	default:
+		return f, errors.NotValid.Newf("[loghttp] Unknown level %q", f.Level)
+	}
+	for _, kv := range q["field"] {
+		i := strings.IndexByte(kv, '=')
+		if i < 1 {
+			return f, errors.NotValid.Newf("[loghttp] Field filter %q must have the format key=value", kv)
+		}
+		if f.Fields == nil {
+			f.Fields = make(map[string]string)
+		}
+		f.Fields[kv[:i]] = kv[i+1:]
+	}
+	return f, nil
+}
+
+// Match reports whether the entry passes the filter.
+func (f TailFilter) Match(e TailEntry) bool {
+	if f.Level == TailLevelInfo && e.Level != TailLevelInfo {
+		return false
+	}
+	if f.Message != "" && !strings.Contains(e.Message, f.Message) {
+		return false
+	}
+	for k, v := range f.Fields {
+		ev, ok := e.Fields[k]
+		if !ok || fmt.Sprint(ev) != v {
+			return false
+		}
+	}
+	return true
+}
+
+type tailSub struct {
+	filter  TailFilter
+	events  chan TailEntry
+	mu      sync.Mutex
+	dropped int
+}
+
+// send must be called with the lock of the tailState. It never blocks and
+// drops the entry if the client cannot keep up.
+func (sub *tailSub) send(e TailEntry) {
+	if !sub.filter.Match(e) {
+		return
+	}
+	select {
+	case sub.events <- e:
+	default:
+		sub.mu.Lock()
+		sub.dropped++
+		sub.mu.Unlock()
+	}
+}
+
+func (sub *tailSub) takeDropped() int {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	d := sub.dropped
+	sub.dropped = 0
+	return d
+}
+
+// ServeHTTP sends the recorded entries and then streams new ones as
+// Server-Sent Events until the client disconnects. Each event contains a
+// TailEntry as JSON. Events which have been dropped because the client was
+// too slow get reported with a "dropped" event. The query parameters get
+// parsed by ParseTailFilter. A Last-Event-ID header skips already received
+// entries.
+func (t *Tail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "[loghttp] Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	filter, err := ParseTailFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	s := t.s
+	sub := &tailSub{
+		filter: filter,
+		events: make(chan TailEntry, s.chanSize),
+	}
+	s.mu.Lock()
+	recent := s.snapshot()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, sub)
+		s.mu.Unlock()
+	}()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var buf []byte
+	for _, e := range recent {
+		if e.ID > lastID && filter.Match(e) {
+			buf = appendTailEvent(buf, e)
+		}
+	}
+	if _, err := w.Write(buf); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	var keepAlive <-chan time.Time
+	if s.keepAlive > 0 {
+		tk := time.NewTicker(s.keepAlive)
+		defer tk.Stop()
+		keepAlive = tk.C
+	}
+	for {
+		buf = buf[:0]
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive:
+			buf = append(buf, ": keep-alive\n\n"...)
+		case e := <-sub.events:
+			if d := sub.takeDropped(); d > 0 {
+				buf = append(buf, "event: dropped\ndata: {\"dropped\":"...)
+				buf = strconv.AppendInt(buf, int64(d), 10)
+				buf = append(buf, "}\n\n"...)
+			}
+			buf = appendTailEvent(buf, e)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func appendTailEvent(buf []byte, e TailEntry) []byte {
+	data, err := json.Marshal(e)
+	if err != nil {
+		e.Fields = map[string]interface{}{log.KeyNameError: err.Error()}
+		data, _ = json.Marshal(e)
+	}
+	buf = append(buf, "id: "...)
+	buf = strconv.AppendUint(buf, e.ID, 10)
+	buf = append(buf, "\ndata: "...)
+	buf = append(buf, data...)
+	return append(buf, "\n\n"...)
+}
+
+// tailFields collects fields into a map. The fields of Marshalers and nested
+// fields get prefixed with the key of the namespace, like "db.rows".
+type tailFields struct {
+	m      map[string]interface{}
+	prefix string
+}
+
+func (tf tailFields) set(key string, value interface{}) {
+	tf.m[tf.prefix+key] = value
+}
+
+func (tf tailFields) AddBool(k string, v bool)       { tf.set(k, v) }
+func (tf tailFields) AddFloat64(k string, v float64) { tf.set(k, v) }
+func (tf tailFields) AddInt(k string, v int)         { tf.set(k, v) }
+func (tf tailFields) AddInt64(k string, v int64)     { tf.set(k, v) }
+func (tf tailFields) AddUint64(k string, v uint64)   { tf.set(k, v) }
+func (tf tailFields) AddString(k string, v string)   { tf.set(k, v) }
+
+// AddObject stores the fmt representation because not every object can be
+// encoded as JSON.
+func (tf tailFields) AddObject(k string, v interface{}) {
+	tf.set(k, fmt.Sprintf("%+v", v))
+}
+
+func (tf tailFields) AddMarshaler(key string, v log.Marshaler) error {
+	if err := tf.Nest(key, v.MarshalLog); err != nil {
+		tf.set(log.KeyNameError, fmt.Sprintf("%+v", err))
+	}
+	return nil
+}
+
+func (tf tailFields) Nest(key string, f func(log.KeyValuer) error) error {
+	return errors.WithStack(f(tailFields{m: tf.m, prefix: tf.prefix + key + "."}))
+}
@@ -0,0 +1,219 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var (
+	_ log.Logger   = (*loghttp.Tail)(nil)
+	_ http.Handler = (*loghttp.Tail)(nil)
+)
+
+func TestTail_Entries(t *testing.T) {
+	tl := loghttp.NewTail(3)
+	l := tl.With(log.String("user", "alice"))
+	tl.Info("one")
+	l.Debug("two", log.Int("n", 2))
+	l.Info("three", log.Nest("db", log.Uint64("rows", 7)), log.Object("obj", struct{ A int }{1}))
+	tl.Info("four")
+
+	es := tl.Entries()
+	assert.Exactly(t, 3, len(es))
+	assert.Exactly(t, uint64(2), es[0].ID)
+	assert.Exactly(t, "debug", es[0].Level)
+	assert.Exactly(t, map[string]interface{}{"user": "alice", "n": 2}, es[0].Fields)
+	assert.Exactly(t, map[string]interface{}{"user": "alice", "db.rows": uint64(7), "obj": "{A:1}"}, es[1].Fields)
+	assert.Exactly(t, "four", es[2].Message)
+
+	noDebug := loghttp.NewTail(3, loghttp.WithTailDebug(false))
+	noDebug.Debug("ignored")
+	assert.False(t, noDebug.IsDebug())
+	assert.Exactly(t, 0, len(noDebug.Entries()))
+}
+
+type tailMarshaler struct{ err error }
+
+func (m tailMarshaler) MarshalLog(kv log.KeyValuer) error {
+	kv.AddInt("hits", 3)
+	return m.err
+}
+
+func TestTail_Marshaler(t *testing.T) {
+	tl := loghttp.NewTail(2)
+	tl.Info("ok", log.Marshal("cache", tailMarshaler{}), log.Int("n", 1))
+	tl.Info("failed", log.Marshal("cache", tailMarshaler{err: errors.New("miss")}), log.Int("n", 2))
+
+	es := tl.Entries()
+	assert.Exactly(t, map[string]interface{}{"cache.hits": 3, "n": 1}, es[0].Fields)
+	assert.Exactly(t, 3, es[1].Fields["cache.hits"])
+	assert.Exactly(t, 2, es[1].Fields["n"], "A failing Marshaler must not drop the following fields")
+	assert.Contains(t, es[1].Fields["error"], "miss")
+}
+
+func TestTail_With_EvaluatesOnce(t *testing.T) {
+	tl := loghttp.NewTail(3)
+	var calls int
+	l := tl.With(log.StringFn("calls", func(add log.AddStringFn) error {
+		calls++
+		add("calls", strconv.Itoa(calls))
+		return nil
+	}), log.Nest("db", log.Int("pool", 4)))
+	l.Info("first")
+	l.Info("second")
+	assert.Exactly(t, 1, calls, "With must evaluate the fields once")
+
+	es := tl.Entries()
+	assert.Exactly(t, 2, len(es))
+	assert.Exactly(t, map[string]interface{}{"calls": "1", "db.pool": 4}, es[1].Fields)
+}
+
+func TestParseTailFilter(t *testing.T) {
+	_, err := loghttp.ParseTailFilter(map[string][]string{"level": {"warn"}})
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	_, err = loghttp.ParseTailFilter(map[string][]string{"field": {"user"}})
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+
+	f, err := loghttp.ParseTailFilter(map[string][]string{"level": {"info"}, "q": {"log"}, "field": {"user=alice", "n=2"}})
+	assert.NoError(t, err)
+	assert.True(t, f.Match(loghttp.TailEntry{Level: "info", Message: "login", Fields: map[string]interface{}{"user": "alice", "n": 2}}))
+	assert.False(t, f.Match(loghttp.TailEntry{Level: "debug", Message: "login", Fields: map[string]interface{}{"user": "alice", "n": 2}}))
+	assert.False(t, f.Match(loghttp.TailEntry{Level: "info", Message: "signup", Fields: map[string]interface{}{"user": "alice", "n": 2}}))
+	assert.False(t, f.Match(loghttp.TailEntry{Level: "info", Message: "login", Fields: map[string]interface{}{"user": "bob", "n": 2}}))
+}
+
+func TestTail_ServeHTTP(t *testing.T) {
+	tl := loghttp.NewTail(10)
+	tl.Info("old", log.String("user", "alice"))
+	tl.Info("old", log.String("user", "bob"))
+
+	srv := httptest.NewServer(tl)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/debug/logs?level=info&field=user=alice", nil)
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Exactly(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	sc := bufio.NewScanner(res.Body)
+	readEvent := func() string {
+		var lines []string
+		for sc.Scan() {
+			if sc.Text() == "" {
+				return strings.Join(lines, "\n")
+			}
+			lines = append(lines, sc.Text())
+		}
+		return strings.Join(lines, "\n")
+	}
+	assert.Regexp(t, `^id: 1\ndata: {"id":1,"time":"[^"]+","level":"info","msg":"old","fields":{"user":"alice"}}$`, readEvent())
+
+	tl.Debug("new", log.String("user", "alice"))
+	tl.Info("new", log.String("user", "bob"))
+	tl.Info("new", log.String("user", "alice"))
+	assert.Regexp(t, `^id: 5\ndata: {"id":5,.+"msg":"new","fields":{"user":"alice"}}$`, readEvent())
+
+	res2, err := http.Get(srv.URL + "?level=error")
+	assert.NoError(t, err)
+	res2.Body.Close()
+	assert.Exactly(t, http.StatusBadRequest, res2.StatusCode)
+}
+
+// blockingWriter signals the first Write and blocks the second Write until
+// release gets closed.
+type blockingWriter struct {
+	httptest.ResponseRecorder
+	mu      sync.Mutex
+	writes  int
+	started chan struct{}
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (bw *blockingWriter) Write(p []byte) (int, error) {
+	bw.mu.Lock()
+	bw.writes++
+	n := bw.writes
+	bw.mu.Unlock()
+	switch n {
+	case 1:
+		close(bw.started)
+	case 2:
+		close(bw.entered)
+		<-bw.release
+	}
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.ResponseRecorder.Write(p)
+}
+
+func (bw *blockingWriter) String() string {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.Body.String()
+}
+
+func TestTail_SlowClient(t *testing.T) {
+	tl := loghttp.NewTail(10, loghttp.WithTailClientBuffer(1), loghttp.WithTailKeepAlive(0))
+	bw := &blockingWriter{
+		ResponseRecorder: *httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		entered:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tl.ServeHTTP(bw, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		close(done)
+	}()
+
+	<-bw.started
+	tl.Info("e1")
+	<-bw.entered
+	tl.Info("e2")
+	tl.Info("e3")
+	tl.Info("e4")
+	close(bw.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(bw.String(), `"msg":"e2"`) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	out := bw.String()
+	assert.Contains(t, out, `"msg":"e1"`)
+	assert.Contains(t, out, "event: dropped\ndata: {\"dropped\":2}\n\nid: 2\n")
+	assert.NotContains(t, out, `"msg":"e3"`)
+	assert.NotContains(t, out, `"msg":"e4"`)
+}
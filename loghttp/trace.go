@@ -0,0 +1,168 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/log"
+)
+
+// Trace records the timing breakdown of an outgoing request via
+// httptrace.ClientTrace. It implements log.Marshaler and gets logged as a
+// nested field with log.Marshal. All durations get logged as nanoseconds, same
+// as log.Duration. Phases which did not happen, e.g. DNS lookup for an IP
+// address or connect for a reused connection, get omitted. Trace is safe for
+// concurrent use.
+type Trace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	done         time.Time
+	reused       bool
+	wasIdle      bool
+	idleTime     time.Duration
+	remoteAddr   string
+	tlsVersion   uint16
+}
+
+// WithClientTrace returns a shallow copy of req with an attached
+// httptrace.ClientTrace which records into the returned Trace. Already attached
+// ClientTraces in the context of req still get called. Call Trace.Done once
+// the response headers have been received, i.e. when RoundTrip returns.
+func WithClientTrace(req *http.Request) (*http.Request, *Trace) {
+	t := &Trace{start: log.Now()}
+	ct := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone)
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() { // the dialer might race several connects
+				t.connectStart = log.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.set(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			t.mu.Lock()
+			t.tlsDone = log.Now()
+			if err == nil {
+				t.tlsVersion = cs.Version
+			}
+			t.mu.Unlock()
+		},
+		GotConn: func(gci httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = gci.Reused
+			t.wasIdle = gci.WasIdle
+			t.idleTime = gci.IdleTime
+			if gci.Conn != nil {
+				t.remoteAddr = gci.Conn.RemoteAddr().String()
+			}
+			t.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.set(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ct)), t
+}
+
+func (t *Trace) set(tm *time.Time) {
+	t.mu.Lock()
+	*tm = log.Now()
+	t.mu.Unlock()
+}
+
+// Done marks the end of the round trip. Subsequent calls have no effect.
+func (t *Trace) Done() {
+	t.mu.Lock()
+	if t.done.IsZero() {
+		t.done = log.Now()
+	}
+	t.mu.Unlock()
+}
+
+func addSpan(kv log.KeyValuer, key string, from, to time.Time) {
+	if !from.IsZero() && !to.IsZero() {
+		kv.AddInt64(key, int64(to.Sub(from)))
+	}
+}
+
+// MarshalLog implements log.Marshaler and writes the keys dns_lookup, connect,
+// tls_handshake, server_processing, ttfb, round_trip, conn_reused,
+// conn_was_idle, conn_idle_time, remote_addr and tls_version. round_trip lasts
+// from the start until Done and does not contain reading the response body.
+func (t *Trace) MarshalLog(kv log.KeyValuer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addSpan(kv, "dns_lookup", t.dnsStart, t.dnsDone)
+	addSpan(kv, "connect", t.connectStart, t.connectDone)
+	addSpan(kv, "tls_handshake", t.tlsStart, t.tlsDone)
+	addSpan(kv, "server_processing", t.wroteRequest, t.firstByte)
+	addSpan(kv, "ttfb", t.start, t.firstByte)
+	addSpan(kv, "round_trip", t.start, t.done)
+	kv.AddBool("conn_reused", t.reused)
+	kv.AddBool("conn_was_idle", t.wasIdle)
+	if t.wasIdle {
+		kv.AddInt64("conn_idle_time", int64(t.idleTime))
+	}
+	if t.remoteAddr != "" {
+		kv.AddString("remote_addr", t.remoteAddr)
+	}
+	if t.tlsVersion > 0 {
+		kv.AddString("tls_version", tlsVersionName(t.tlsVersion))
+	}
+	return nil
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+	return "unknown"
+}
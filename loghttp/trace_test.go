@@ -0,0 +1,90 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/loghttp"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var traceKeyRe = regexp.MustCompile(`(\w+): `)
+
+// traceKeys returns the keys written by the Trace in their order.
+func traceKeys(tr *loghttp.Trace) []string {
+	var keys []string
+	for _, m := range traceKeyRe.FindAllStringSubmatch(log.Fields{log.Marshal("trace", tr)}.ToString(""), -1) {
+		keys = append(keys, m[1])
+	}
+	return keys
+}
+
+func traceRequest(t *testing.T, c *http.Client, url string) *loghttp.Trace {
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+	req, tr := loghttp.WithClientTrace(req)
+	res, err := c.Do(req)
+	assert.NoError(t, err)
+	tr.Done()
+	_, err = ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Body.Close())
+	return tr
+}
+
+func TestWithClientTrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`OK`))
+	}))
+	defer srv.Close()
+	c := srv.Client()
+
+	tr := traceRequest(t, c, srv.URL)
+	assert.Exactly(t, []string{
+		"connect", "server_processing", "ttfb", "round_trip",
+		"conn_reused", "conn_was_idle", "remote_addr",
+	}, traceKeys(tr))
+
+	tr = traceRequest(t, c, srv.URL)
+	assert.Exactly(t, []string{
+		"server_processing", "ttfb", "round_trip",
+		"conn_reused", "conn_was_idle", "conn_idle_time", "remote_addr",
+	}, traceKeys(tr), "A reused connection must not log connect")
+}
+
+func TestWithClientTrace_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`OK`))
+	}))
+	defer srv.Close()
+
+	tr := traceRequest(t, srv.Client(), srv.URL)
+	assert.Exactly(t, []string{
+		"connect", "tls_handshake", "server_processing", "ttfb", "round_trip",
+		"conn_reused", "conn_was_idle", "remote_addr", "tls_version",
+	}, traceKeys(tr))
+}
+
+func TestTrace_NotDone(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://corestore.io", nil)
+	_, tr := loghttp.WithClientTrace(req)
+	assert.Exactly(t, []string{"conn_reused", "conn_was_idle"}, traceKeys(tr), "Spans without an end get omitted")
+}
@@ -0,0 +1,171 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// Transport wraps an http.RoundTripper and logs each outgoing request with
+// Info level. If Debug level has been enabled and DumpBody is true, a second
+// entry with Debug level contains the dumped request and response. The zero
+// value can be used but logs nothing.
+type Transport struct {
+	// Base defines the RoundTripper which executes the request. If nil,
+	// http.DefaultTransport gets used.
+	Base http.RoundTripper
+	// Logger receives the entries. If nil, nothing gets logged.
+	Logger log.Logger
+	// Message defines the message of each entry. Defaults to
+	// "[loghttp] Transport".
+	Message string
+	// DumpBody enables dumping of the request and response including their
+	// bodies when Debug level is enabled. Body size limit and content types
+	// get defined by the Dumper. The transmitted bodies stay untouched.
+	DumpBody bool
+	// Trace attaches an httptrace.ClientTrace to each request and logs the
+	// timing breakdown as nested field "trace". See type Trace.
+	Trace bool
+	// Dumper redacts secrets in the logged URL and limits the dumps. If nil,
+	// DefaultDumper gets used.
+	Dumper *Dumper
+}
+
+// NewTransport creates a new logging Transport which wraps base.
+func NewTransport(l log.Logger, base http.RoundTripper) *Transport {
+	return &Transport{
+		Base:   base,
+		Logger: l,
+	}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) dumper() *Dumper {
+	if t.Dumper == nil {
+		return DefaultDumper
+	}
+	return t.Dumper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := t.Logger
+	if l == nil || !l.IsInfo() {
+		return t.base().RoundTrip(req)
+	}
+
+	dump := t.DumpBody && l.IsDebug()
+	var reqDump log.Field
+	if dump {
+		req, reqDump = t.dumpRequest(req)
+	}
+
+	var tr *Trace
+	if t.Trace {
+		req, tr = WithClientTrace(req)
+	}
+
+	start := log.Now()
+	res, err := t.base().RoundTrip(req)
+	dur := log.Now().Sub(start)
+
+	fields := log.Fields{
+		log.String("method", req.Method),
+		log.String("url", t.dumper().Redactor.URL(req.URL).String()),
+		log.Duration(log.KeyNameDuration, dur),
+	}
+	// An unknown length, e.g. of a chunked body, gets omitted. For client
+	// requests a zero length with a body is unknown, too.
+	if req.ContentLength > 0 || (req.ContentLength == 0 && (req.Body == nil || req.Body == http.NoBody)) {
+		fields = append(fields, log.Int64("request_bytes", req.ContentLength))
+	}
+	if res != nil {
+		fields = append(fields, log.Int("status", res.StatusCode))
+		if res.ContentLength >= 0 {
+			fields = append(fields, log.Int64("response_bytes", res.ContentLength))
+		}
+	}
+	if err != nil {
+		fields = append(fields, log.Err(err))
+	}
+	if tr != nil {
+		tr.Done()
+		fields = append(fields, log.Marshal("trace", tr))
+	}
+	msg := t.Message
+	if msg == "" {
+		msg = "[loghttp] Transport"
+	}
+	l.Info(msg, fields...)
+
+	if dump {
+		dfs := log.Fields{fields[0], fields[1], reqDump}
+		if res != nil {
+			var resDump log.Field
+			res, resDump = t.dumpResponse(res)
+			dfs = append(dfs, resDump)
+		}
+		l.Debug(msg, dfs...)
+	}
+	return res, err
+}
+
+// dumpRequest returns a shallow copy of req whose body can still be fully read
+// and the field with the dumped request. Dump errors get logged instead of the
+// dump.
+func (t *Transport) dumpRequest(req *http.Request) (*http.Request, log.Field) {
+	const key = "request"
+	d := t.dumper()
+	b, err := httputil.DumpRequestOut(d.redactRequest(req), false)
+	if err != nil {
+		return req, log.ErrWithKey(key, errors.Wrap(err, "[loghttp] Transport.DumpRequestOut"))
+	}
+	b, body, err := d.dumpBody(b, req.Header, req.Body, req.ContentLength)
+	if body != req.Body {
+		req = ShallowCloneRequest(req)
+		req.Body = body
+	}
+	if err != nil {
+		return req, log.ErrWithKey(key, errors.Wrap(err, "[loghttp] Transport.dumpBody"))
+	}
+	return req, log.String(key, string(b))
+}
+
+// dumpResponse replaces the body of res with a body which can still be fully
+// read and returns the field with the dumped response. Dump errors get logged
+// instead of the dump.
+func (t *Transport) dumpResponse(res *http.Response) (*http.Response, log.Field) {
+	const key = "response"
+	d := t.dumper()
+	b, err := httputil.DumpResponse(d.redactResponse(res), false)
+	if err != nil {
+		return res, log.ErrWithKey(key, errors.Wrap(err, "[loghttp] Transport.DumpResponse"))
+	}
+	b, res.Body, err = d.dumpBody(b, res.Header, res.Body, res.ContentLength)
+	if err != nil {
+		return res, log.ErrWithKey(key, errors.Wrap(err, "[loghttp] Transport.dumpBody"))
+	}
+	return res, log.String(key, string(b))
+}
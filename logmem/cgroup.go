@@ -0,0 +1,339 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// DefaultCgroupRoot defines the mount point of the cgroup file system. In a
+// container it contains the cgroup of the container.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// DefaultCgroupSelf defines the file which lists the cgroups of the process.
+const DefaultCgroupSelf = "/proc/self/cgroup"
+
+// cgroupV1Unlimited is the threshold above which a cgroup v1 limit counts as
+// unlimited. The kernel reports the maximum page aligned int64.
+const cgroupV1Unlimited = 1 << 62
+
+// CgroupMemory contains the memory accounting of a cgroup.
+type CgroupMemory struct {
+	// Version of the cgroup, 1 or 2.
+	Version int
+	// Limit in bytes, zero if unlimited. Read from memory.max or
+	// memory.limit_in_bytes.
+	Limit uint64
+	// Usage in bytes. Read from memory.current or memory.usage_in_bytes.
+	Usage uint64
+	// Stat contains the values of memory.stat.
+	Stat map[string]uint64
+}
+
+// Percent returns the usage in percent of the limit, zero if unlimited.
+func (c CgroupMemory) Percent() float64 {
+	if c.Limit == 0 {
+		return 0
+	}
+	return math.Round(float64(c.Usage)/float64(c.Limit)*100*100) / 100
+}
+
+// MarshalLog implements log.Marshaler.
+func (c CgroupMemory) MarshalLog(kv log.KeyValuer) error {
+	kv.AddInt("version", c.Version)
+	kv.AddFloat64("limit_mb", ToMB(c.Limit))
+	kv.AddFloat64("usage_mb", ToMB(c.Usage))
+	kv.AddFloat64("usage_percent", c.Percent())
+	return nil
+}
+
+// ReadCgroupMemory reads the memory accounting of the cgroup of the process.
+// root defines the mount point of the cgroup file system and defaults to
+// DefaultCgroupRoot. self defines the file which lists the cgroups of the
+// process and defaults to DefaultCgroupSelf. cgroup v2 gets detected by the
+// file cgroup.controllers and uses the "0::/path" line, otherwise cgroup v1
+// gets read from the memory subdirectory and uses the line of the memory
+// controller. If the path does not exist below root, root itself gets read,
+// because in a container without cgroup namespace root is already the cgroup
+// of the container. Returns a NotFound error if no memory controller or
+// accounting file exists, for example outside of Linux or for the root
+// cgroup.
+func ReadCgroupMemory(root, self string) (CgroupMemory, error) {
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+	if self == "" {
+		self = DefaultCgroupSelf
+	}
+	v2Path, v1Path, err := readCgroupSelf(self)
+	if err != nil {
+		return CgroupMemory{}, errors.WithStack(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroup(cgroupDir(root, v2Path, "memory.current"), 2, "memory.max", "memory.current")
+	}
+	dir := filepath.Join(root, "memory")
+	if _, err := os.Stat(dir); err == nil {
+		return readCgroup(cgroupDir(dir, v1Path, "memory.usage_in_bytes"), 1, "memory.limit_in_bytes", "memory.usage_in_bytes")
+	}
+	return CgroupMemory{}, errors.NotFound.Newf("[logmem] No cgroup memory controller found in %q", root)
+}
+
+// readCgroupSelf returns the cgroup paths of the process from the lines
+// "hierarchy-ID:controller-list:path". A missing file returns the root paths.
+func readCgroupSelf(file string) (v2Path, v1Path string, _ error) {
+	v2Path, v1Path = "/", "/"
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return v2Path, v1Path, nil
+	}
+	if err != nil {
+		return "", "", errors.Wrapf(err, "[logmem] Failed to read %q", file)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fs := strings.SplitN(sc.Text(), ":", 3)
+		if len(fs) != 3 {
+			continue
+		}
+		if fs[0] == "0" && fs[1] == "" {
+			v2Path = fs[2]
+			continue
+		}
+		for _, c := range strings.Split(fs[1], ",") {
+			if c == "memory" {
+				v1Path = fs[2]
+			}
+		}
+	}
+	return v2Path, v1Path, nil
+}
+
+// cgroupDir returns the directory of the cgroup path below base, or base if
+// the path does not contain the probe file.
+func cgroupDir(base, path, probe string) string {
+	dir := filepath.Join(base, path)
+	if _, err := os.Stat(filepath.Join(dir, probe)); err != nil {
+		return base
+	}
+	return dir
+}
+
+func readCgroup(dir string, version int, limitFile, usageFile string) (c CgroupMemory, err error) {
+	c.Version = version
+	if c.Limit, err = readCgroupValue(filepath.Join(dir, limitFile)); err != nil {
+		return c, errors.WithStack(err)
+	}
+	if version == 1 && c.Limit >= cgroupV1Unlimited {
+		c.Limit = 0
+	}
+	if c.Usage, err = readCgroupValue(filepath.Join(dir, usageFile)); err != nil {
+		return c, errors.WithStack(err)
+	}
+	c.Stat, err = readCgroupStat(filepath.Join(dir, "memory.stat"))
+	return c, errors.WithStack(err)
+}
+
+// readCgroupValue reads a single number. "max" returns zero.
+func readCgroupValue(file string) (uint64, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, errors.NotFound.New(err, "[logmem] Failed to read %q", file)
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "[logmem] Failed to read %q", file)
+	}
+	data = bytes.TrimSpace(data)
+	if string(data) == "max" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, errors.NotValid.New(err, "[logmem] Failed to parse %q", file)
+	}
+	return v, nil
+}
+
+// readCgroupStat parses the "key value" lines of memory.stat. A missing file
+// returns an empty map.
+func readCgroupStat(file string) (map[string]uint64, error) {
+	stat := map[string]uint64{}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return stat, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "[logmem] Failed to read %q", file)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fs := bytes.Fields(sc.Bytes())
+		if len(fs) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(string(fs[1]), 10, 64)
+		if err != nil {
+			return nil, errors.NotValid.New(err, "[logmem] Failed to parse %q in %q", fs[0], file)
+		}
+		stat[string(fs[0])] = v
+	}
+	return stat, nil
+}
+
+// CgroupOptions configures PeriodicallyCgroup.
+type CgroupOptions struct {
+	// Root of the cgroup file system. Defaults to DefaultCgroupRoot.
+	Root string
+	// Self lists the cgroups of the process. Defaults to DefaultCgroupSelf.
+	Self string
+	// Interval between two checks. Defaults to one minute.
+	Interval time.Duration
+	// Usage defines which change of the usage, compared to the last logged
+	// value, logs an entry. Defaults to 10% growth or shrink.
+	Usage Threshold
+	// WarnPercent logs the WarnMessage once the usage reaches WarnPercent of
+	// the limit. The warning gets logged again after the usage has dropped
+	// below. Defaults to 90.
+	WarnPercent float64
+	// StatKeys selects the values of memory.stat which get logged if they
+	// exist. Defaults to the anonymous and file memory of cgroup v1 and v2.
+	StatKeys []string
+	// Message of the log entry. Defaults to "[logmem] cgroup memory".
+	Message string
+	// WarnMessage of the log entry. Defaults to
+	// "[logmem] WARNING cgroup memory limit approaching".
+	WarnMessage string
+	// Fields get added to each log entry.
+	Fields log.Fields
+}
+
+// PeriodicallyCgroup logs the memory usage of the cgroup relative to its
+// limit together with the Go heap and the GOMEMLIMIT. In containers this is
+// the number which decides about the OOM killer, not the Sys value of the Go
+// runtime. The cgroup gets read once before starting the goroutine, to return
+// an error if it does not exist. Read errors in the goroutine get logged.
+// Debug level logs the termination of the goroutine.
+func PeriodicallyCgroup(ctx context.Context, l log.Logger, o CgroupOptions) (*Periodic, error) {
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Usage == (Threshold{}) {
+		o.Usage = Threshold{GrowthPercent: 10, ShrinkPercent: 10}
+	}
+	if o.WarnPercent <= 0 {
+		o.WarnPercent = 90
+	}
+	if o.StatKeys == nil {
+		o.StatKeys = []string{"anon", "file", "rss", "cache"}
+	}
+	if o.Message == "" {
+		o.Message = "[logmem] cgroup memory"
+	}
+	if o.WarnMessage == "" {
+		o.WarnMessage = "[logmem] WARNING cgroup memory limit approaching"
+	}
+
+	prev, err := ReadCgroupMemory(o.Root, o.Self)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return NewPeriodic(ctx, func(ctx context.Context) {
+		tick := time.NewTicker(o.Interval)
+		defer tick.Stop()
+		warned := false
+		for {
+			select {
+			case <-tick.C:
+				if !l.IsInfo() {
+					continue
+				}
+				cur, err := ReadCgroupMemory(o.Root, o.Self)
+				if err != nil {
+					l.Info(o.Message, append(log.Fields{log.Err(err)}, o.Fields...)...)
+					continue
+				}
+				warn := cur.Limit > 0 && cur.Percent() >= o.WarnPercent
+				switch {
+				case warn && !warned:
+					l.Info(o.WarnMessage, append(cgroupFields(prev, cur, o.StatKeys), o.Fields...)...)
+					prev = cur
+				case o.Usage.Exceeded(prev.Usage, cur.Usage):
+					l.Info(o.Message, append(cgroupFields(prev, cur, o.StatKeys), o.Fields...)...)
+					prev = cur
+				}
+				warned = warn
+			case <-ctx.Done():
+				if l.IsDebug() {
+					l.Debug("logmem.PeriodicallyCgroup.terminated.done", log.Err(ctx.Err()))
+				}
+				return
+			}
+		}
+	}), nil
+}
+
+var goMemorySamples = []string{"/memory/classes/heap/objects:bytes", "/memory/classes/total:bytes", "/gc/gomemlimit:bytes"}
+
+func cgroupFields(prev, cur CgroupMemory, statKeys []string) log.Fields {
+	fields := log.Fields{
+		log.Int("cgroup_version", cur.Version),
+		log.Float64("cgroup_limit_mb", ToMB(cur.Limit)),
+		log.Float64("cgroup_usage_mb", ToMB(cur.Usage)),
+		log.Float64("cgroup_usage_percent", cur.Percent()),
+		log.Float64("diff_cgroup_usage_mb", DiffMB(prev.Usage, cur.Usage)),
+	}
+	for _, k := range statKeys {
+		if v, ok := cur.Stat[k]; ok {
+			fields = append(fields, log.Float64("cgroup_"+k+"_mb", ToMB(v)))
+		}
+	}
+
+	// GOMEMLIMIT exists as runtime metric since Go 1.21, older versions can
+	// only report the environment variable.
+	samples := make([]metrics.Sample, len(goMemorySamples))
+	for i, name := range goMemorySamples {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	fields = append(fields,
+		log.Float64("heap_alloc_mb", ToMB(samples[0].Value.Uint64())),
+		log.Float64("sys_mb", ToMB(samples[1].Value.Uint64())),
+	)
+	memLimit := os.Getenv("GOMEMLIMIT")
+	if samples[2].Value.Kind() == metrics.KindUint64 {
+		memLimit = "off"
+		if v := samples[2].Value.Uint64(); v < math.MaxInt64 {
+			memLimit = strconv.FormatUint(v, 10)
+		}
+	}
+	if memLimit == "" {
+		memLimit = "off"
+	}
+	return append(fields, log.String("gomemlimit", memLimit))
+}
@@ -0,0 +1,215 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logmem"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+// writeCgroupFiles replaces the files atomically, so a concurrent read never
+// sees a truncated file.
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path+".tmp", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCgroupMemory(t *testing.T) {
+	t.Run("v2", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"cgroup.controllers": "cpu io memory pids\n",
+			"memory.max":         "1073741824\n",
+			"memory.current":     "268435456\n",
+			"memory.stat":        "anon 134217728\nfile 67108864\nkernel_stack 163840\n",
+		})
+		c, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.NoError(t, err)
+		assert.Exactly(t, 2, c.Version)
+		assert.Exactly(t, uint64(1<<30), c.Limit)
+		assert.Exactly(t, uint64(1<<28), c.Usage)
+		assert.Exactly(t, 25.0, c.Percent())
+		assert.Exactly(t, uint64(163840), c.Stat["kernel_stack"])
+
+		assert.Exactly(t, "version: 2 limit_mb: 1024 usage_mb: 256 usage_percent: 25\n",
+			log.Fields{log.Marshal("cgroup", c)}.ToString("")[1:])
+	})
+	t.Run("v2 unlimited", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"cgroup.controllers": "memory\n",
+			"memory.max":         "max\n",
+			"memory.current":     "4096\n",
+		})
+		c, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(0), c.Limit)
+		assert.Exactly(t, 0.0, c.Percent())
+		assert.Empty(t, c.Stat)
+	})
+	t.Run("v1", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"memory/memory.limit_in_bytes": "9223372036854771712\n",
+			"memory/memory.usage_in_bytes": "8192\n",
+			"memory/memory.stat":           "cache 4096\nrss 4096\n",
+		})
+		c, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.NoError(t, err)
+		assert.Exactly(t, 1, c.Version)
+		assert.Exactly(t, uint64(0), c.Limit)
+		assert.Exactly(t, uint64(8192), c.Usage)
+		assert.Exactly(t, uint64(4096), c.Stat["rss"])
+	})
+	t.Run("v2 path", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"self":                                 "0::/app.slice/svc.service\n",
+			"cgroup.controllers":                   "memory\n",
+			"app.slice/svc.service/memory.max":     "2048\n",
+			"app.slice/svc.service/memory.current": "1024\n",
+		})
+		c, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(2048), c.Limit)
+		assert.Exactly(t, uint64(1024), c.Usage)
+	})
+	t.Run("v2 root cgroup", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"self":               "0::/\n",
+			"cgroup.controllers": "memory\n",
+			"memory.stat":        "anon 4096\n",
+		})
+		_, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+	t.Run("v1 path", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"self":                                    "5:cpu,cpuacct:/other\n4:memory:/docker/abc\n0::/\n",
+			"memory/memory.limit_in_bytes":            "9223372036854771712\n",
+			"memory/memory.usage_in_bytes":            "8192\n",
+			"memory/docker/abc/memory.limit_in_bytes": "4096\n",
+			"memory/docker/abc/memory.usage_in_bytes": "2048\n",
+		})
+		c, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(4096), c.Limit)
+		assert.Exactly(t, uint64(2048), c.Usage)
+	})
+	t.Run("v1 container", func(t *testing.T) {
+		// Without cgroup namespace the path of the host does not exist in
+		// the container, its mount contains the cgroup of the container.
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"self":                         "4:memory:/docker/abc\n",
+			"memory/memory.limit_in_bytes": "4096\n",
+			"memory/memory.usage_in_bytes": "1024\n",
+		})
+		c, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(4096), c.Limit)
+		assert.Exactly(t, uint64(1024), c.Usage)
+	})
+	t.Run("v1 usage missing", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"memory/memory.limit_in_bytes": "4096\n",
+		})
+		_, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+	t.Run("not found", func(t *testing.T) {
+		_, err := logmem.ReadCgroupMemory(t.TempDir(), "testdata/missing")
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		root := t.TempDir()
+		writeCgroupFiles(t, root, map[string]string{
+			"cgroup.controllers": "memory\n",
+			"memory.max":         "lots\n",
+		})
+		_, err := logmem.ReadCgroupMemory(root, filepath.Join(root, "self"))
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
+
+func TestPeriodicallyCgroup(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "memory\n",
+		"memory.max":         "1048576000\n",
+		"memory.current":     "104857600\n",
+		"memory.stat":        "anon 52428800\nfile 10485760\n",
+	})
+
+	var buf log.MutexBuffer
+	l := logw.NewLog(logw.WithWriter(&buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	p, err := logmem.PeriodicallyCgroup(ctx, l, logmem.CgroupOptions{
+		Root:     root,
+		Self:     filepath.Join(root, "self"),
+		Interval: time.Millisecond,
+		Usage:    logmem.Threshold{GrowthAbs: 100 << 20},
+		Fields:   log.Fields{log.String("app", "test")},
+	})
+	assert.NoError(t, err)
+
+	writeCgroupFiles(t, root, map[string]string{"memory.current": "314572800\n"})
+	assert.NoError(t, buf.WaitFor(ctx, "[logmem] cgroup memory "))
+
+	writeCgroupFiles(t, root, map[string]string{"memory.current": "996147200\n"})
+	assert.NoError(t, buf.WaitFor(ctx, "[logmem] WARNING cgroup memory limit approaching"))
+	p.Stop()
+
+	out := buf.String()
+	assert.Contains(t, out, "INFO [logmem] cgroup memory cgroup_version: 2 cgroup_limit_mb: 1000 cgroup_usage_mb: 300 cgroup_usage_percent: 30 diff_cgroup_usage_mb: 200 cgroup_anon_mb: 50 cgroup_file_mb: 10 heap_alloc_mb: ")
+	assert.Contains(t, out, "INFO [logmem] WARNING cgroup memory limit approaching cgroup_version: 2 cgroup_limit_mb: 1000 cgroup_usage_mb: 950 cgroup_usage_percent: 95 diff_cgroup_usage_mb: 650")
+	assert.Contains(t, out, `gomemlimit: "`)
+	assert.Contains(t, out, `app: "test"`)
+	assert.Exactly(t, 1, buf.Count("WARNING"))
+	assert.Exactly(t, 2, buf.Count("INFO"))
+}
+
+func TestPeriodicallyCgroup_NotFound(t *testing.T) {
+	p, err := logmem.PeriodicallyCgroup(context.Background(), logw.NewLog(), logmem.CgroupOptions{Root: t.TempDir(), Self: "testdata/missing"})
+	assert.Nil(t, p)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+}
@@ -13,5 +13,7 @@
 // limitations under the License.
 
 // Package logmem logs periodically or now the memory consumption if there are
-// changes above a specific threshold.
+// changes above a specific threshold. PeriodicallyRuntimeMetrics reads the
+// values from runtime/metrics without stopping the world. A Tracker provides
+// the same numbers as Snapshot for expvar and HTTP scrapers.
 package logmem
@@ -18,12 +18,65 @@ import (
 	"context"
 	"math"
 	"runtime"
-	"sync"
+	"sort"
 	"time"
 
 	"github.com/corestoreio/log"
 )
 
+// Options configures PeriodicallyWithOptions. The zero value logs every minute a change of
+// 10% of HeapAlloc or Sys.
+type Options struct {
+	// Interval between two checks. Defaults to one minute.
+	Interval time.Duration
+	// Thresholds defines the observed metrics and their limits. A change
+	// compared to the last logged value which exceeds any threshold logs all
+	// memory statistics. Defaults to 10% growth or shrink of HeapAlloc and Sys.
+	Thresholds map[Metric]Threshold
+	// Message of the log entry. Defaults to "[logmem] memory diff".
+	Message string
+	// Fields get added to each log entry.
+	Fields log.Fields
+	// Tracker stores each logged Snapshot, so its expvar and HTTP handlers
+	// report the same numbers as the log. Defaults to DefaultTracker.
+	Tracker *Tracker
+}
+
+// Periodic logs in a goroutine until Stop gets called or the context gets
+// cancelled.
+type Periodic struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPeriodic runs fn in a new goroutine and returns its handle. The context
+// passed to fn gets cancelled by Stop or by the parent ctx, then fn must
+// return.
+func NewPeriodic(ctx context.Context, fn func(ctx context.Context)) *Periodic {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Periodic{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		fn(ctx)
+	}()
+	return p
+}
+
+// Stop terminates the goroutine and waits until it has exited. Stop can be
+// called multiple times.
+func (p *Periodic) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Done returns a channel which gets closed after the goroutine has exited.
+func (p *Periodic) Done() <-chan struct{} {
+	return p.done
+}
+
 // Periodically logs the memory statistic in a defined interval. It calls `Now`
 // after the interval duration has been passed. The context cancels the internal
 // goroutine. minDiffBytes sets the minimum amount of bytes between the current
@@ -31,96 +84,134 @@ import (
 // 128MB logs every 128MB change the memory data. This function is meant to be
 // run during the whole life time of a program to track is memory consumption.
 // If Info level in the logger has been disabled, no logging will happen. Debug
-// level logs the termination of the goroutine.
-func Periodically(ctx context.Context, l log.Logger, interval time.Duration, minDiffBytes uint64, fields ...log.Field) {
-	hasChanges := func(current, previous uint64) bool {
-		return previous-current > minDiffBytes
+// level logs the termination of the goroutine. Use PeriodicallyWithOptions for
+// more metrics and thresholds.
+func Periodically(ctx context.Context, l log.Logger, interval time.Duration, minDiffBytes uint64, fields ...log.Field) *Periodic {
+	// The thresholds trigger at minDiffBytes+1 because a change must be
+	// greater than minDiffBytes.
+	th := Threshold{GrowthAbs: minDiffBytes + 1, ShrinkAbs: minDiffBytes + 1}
+	return PeriodicallyWithOptions(ctx, l, Options{
+		Interval: interval,
+		Thresholds: map[Metric]Threshold{
+			MetricHeapAlloc: th,
+			MetricSys:       th,
+		},
+		Fields: fields,
+	})
+}
+
+// PeriodicallyWithOptions logs the memory statistic each time a metric
+// exceeds its threshold, compared to the last logged values. Metrics without
+// a log field of their own, like the goroutine count or the GC pauses, get
+// appended to the entry. If Info level in the logger has been disabled, no
+// logging will happen. Debug level logs the termination of the goroutine.
+//
+//	p := logmem.PeriodicallyWithOptions(ctx, l, logmem.Options{
+//		Interval: 30 * time.Second,
+//		Thresholds: map[logmem.Metric]logmem.Threshold{
+//			logmem.MetricHeapAlloc:  {GrowthAbs: 256 << 20, ShrinkPercent: 50},
+//			logmem.MetricGoroutines: {GrowthPercent: 100},
+//			logmem.MetricGCPauseP99: {GrowthAbs: uint64(10 * time.Millisecond)},
+//		},
+//	})
+//	defer p.Stop()
+func PeriodicallyWithOptions(ctx context.Context, l log.Logger, o Options) *Periodic {
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Thresholds == nil {
+		o.Thresholds = map[Metric]Threshold{
+			MetricHeapAlloc: {GrowthPercent: 10, ShrinkPercent: 10},
+			MetricSys:       {GrowthPercent: 10, ShrinkPercent: 10},
+		}
+	}
+	if o.Message == "" {
+		o.Message = "[logmem] memory diff"
+	}
+	if o.Tracker == nil {
+		o.Tracker = DefaultTracker
 	}
+	metrics := make([]Metric, 0, len(o.Thresholds))
+	withPauses := false
+	for m := range o.Thresholds {
+		metrics = append(metrics, m)
+		withPauses = withPauses || (m >= MetricGCPauseP50 && m <= MetricGCPauseMax)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i] < metrics[j] })
 
-	go func() {
-		tick := time.NewTicker(interval)
+	// prev contains the values of the last log entry and starts with the values
+	// of this call.
+	prev, cur := new(snapshot), new(snapshot)
+	readSnapshot(prev, withPauses)
+
+	return NewPeriodic(ctx, func(ctx context.Context) {
+		tick := time.NewTicker(o.Interval)
 		defer tick.Stop()
-		var prev runtime.MemStats
-		var cur runtime.MemStats
-		runtime.ReadMemStats(&prev)
 		for {
 			select {
 			case <-tick.C:
-				if ctx.Err() != nil {
-					if l.IsDebug() {
-						l.Debug("logmem.Periodically.terminated.error", log.Err(ctx.Err()))
+				if !l.IsInfo() {
+					continue
+				}
+				readSnapshot(cur, withPauses)
+				var triggered []string
+				for _, m := range metrics {
+					if o.Thresholds[m].Exceeded(prev.value(m), cur.value(m)) {
+						triggered = append(triggered, m.String())
 					}
-					return
 				}
-				runtime.ReadMemStats(&cur)
-
-				if l.IsInfo() && (hasChanges(cur.HeapAlloc, prev.HeapAlloc) || hasChanges(cur.Sys, prev.Sys)) {
-					logMemoryStats(l, prev, cur, "[logmem] memory diff", fields...)
+				if len(triggered) == 0 {
+					continue
 				}
-				prev = cur
+				fields := make(log.Fields, 0, len(metrics)+1+len(o.Fields))
+				fields = append(fields, log.Strings("trigger", triggered...))
+				for _, m := range metrics {
+					if f, ok := m.field(cur); ok {
+						fields = append(fields, f)
+					}
+				}
+				logMemoryStats(l, o.Tracker, &prev.mem, &cur.mem, o.Message, append(fields, o.Fields...)...)
+				prev, cur = cur, prev
 			case <-ctx.Done():
 				if l.IsDebug() {
-					l.Debug("logmem.Periodically.terminated.done")
+					l.Debug("logmem.Periodically.terminated.done", log.Err(ctx.Err()))
 				}
 				return
 			}
 		}
-	}()
-}
-
-type statistician struct {
-	mu   sync.Mutex
-	prev runtime.MemStats
-	cur  runtime.MemStats
+	})
 }
 
-var stats = new(statistician)
-
 // Now logs the difference of the memory consumption between the first call and
 // subsequent calls of Now. It stores the previous state of runtime.ReadMemStats
-// in a global variable. If Info level in the logger has been disabled, no
-// logging will happen.
+// in DefaultTracker. If Info level in the logger has been disabled, no logging
+// will happen.
 func Now(l log.Logger, message string, fields ...log.Field) {
 	if l.IsInfo() {
-		stats.mu.Lock()
-		runtime.ReadMemStats(&stats.cur)
-		stats.prev = logMemoryStats(l, stats.prev, stats.cur, message, fields...)
-		stats.mu.Unlock()
+		l.Info(message, append(DefaultTracker.Snapshot().fields(), fields...)...)
 	}
 }
 
-func logMemoryStats(l log.Logger, prev, cur runtime.MemStats, message string, fields ...log.Field) runtime.MemStats {
-	nolo := cur.Mallocs - cur.Frees
-	if nolo > math.MaxUint64-cur.Mallocs { // check overflow
-		nolo = 0
-	}
+func logMemoryStats(l log.Logger, t *Tracker, prev, cur *runtime.MemStats, message string, fields ...log.Field) {
+	l.Info(message, append(t.store(prev, cur).fields(), fields...)...)
+}
 
-	noloPrev := prev.Mallocs - prev.Frees
-	if noloPrev > math.MaxUint64-prev.Mallocs { // check overflow
-		noloPrev = 0
+// Diff returns the signed difference without an underflow of the unsigned
+// values.
+func Diff(prev, cur uint64) int64 {
+	if cur >= prev {
+		return int64(cur - prev)
 	}
+	return -int64(prev - cur)
+}
 
-	// Add more fields if desired.
-	l.Info(message,
-		append(log.Fields{
-			log.Float64("alloc_mb", toMB(cur.Alloc)),
-			log.Float64("heap_alloc_mb", toMB(cur.HeapAlloc)),
-			log.Uint64("heap_objects", cur.HeapObjects),
-			log.Float64("sys_mb", toMB(cur.Sys)),
-			log.Uint64("number_of_live_objects", nolo),
-			log.Uint("num_gc", uint(cur.NumGC)),
-
-			log.Float64("diff_alloc_mb", toMB(cur.Alloc-prev.Alloc)),
-			log.Float64("diff_heap_alloc_mb", toMB(cur.HeapAlloc-prev.HeapAlloc)),
-			log.Uint64("diff_heap_objects", cur.HeapObjects-prev.HeapObjects),
-			log.Float64("diff_sys_mb", toMB(cur.Sys-prev.Sys)),
-			log.Uint64("diff_number_of_live_objects", noloPrev),
-		}, fields...)...,
-	)
-
-	return cur
+// DiffMB returns the signed difference of two byte values in megabytes,
+// rounded to three decimals.
+func DiffMB(prev, cur uint64) float64 {
+	return math.Round(float64(Diff(prev, cur))/1024/1024*1000) / 1000
 }
 
-func toMB(b uint64) float64 {
+// ToMB converts bytes into megabytes, rounded to three decimals.
+func ToMB(b uint64) float64 {
 	return math.Round(float64(b)/1024/1024*1000) / 1000
 }
@@ -17,11 +17,17 @@ package logmem_test
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/corestoreio/log/logmem"
 	"github.com/corestoreio/log/logw"
@@ -29,7 +35,7 @@ import (
 )
 
 func TestPeriodically(t *testing.T) {
-	var buf bytes.Buffer
+	var buf log.MutexBuffer
 	l := logw.NewLog(
 		logw.WithWriter(&buf),
 		logw.WithLevel(logw.LevelInfo),
@@ -38,7 +44,7 @@ func TestPeriodically(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
-	logmem.Periodically(ctx, l, time.Second*2, 1024)
+	logmem.Periodically(ctx, l, time.Millisecond*200, 1024)
 
 	{
 		// generate some noise. maybe there are better ways but for now this seems
@@ -56,13 +62,234 @@ func TestPeriodically(t *testing.T) {
 		srv.CloseClientConnections()
 		srv.Close()
 	}
-	time.Sleep(time.Second * 11)
+	assert.NoError(t, buf.WaitForN(ctx, `[logmem]`, 5))
 
 	logmem.Now(l, "[testlogmem]", log.String("testkey", "testvalue"))
 
 	t.Log("\n", buf.String())
-	assert.True(t, bytes.Count(buf.Bytes(), []byte(`[logmem]`)) >= 5, "Should find at least five log entries")
-	assert.True(t, bytes.Count(buf.Bytes(), []byte(`[testlogmem]`)) == 1, "Should find at least one log entry for testlogmem")
-	assert.True(t, bytes.Count(buf.Bytes(), []byte(`testkey`)) == 1, "Should find at least one log entry for testkey")
-	assert.True(t, bytes.Count(buf.Bytes(), []byte(`testvalue`)) == 1, "Should find at least one log entry for testvalue")
+	assert.True(t, buf.Count(`[logmem]`) >= 5, "Should find at least five log entries")
+	assert.True(t, buf.Count(`[testlogmem]`) == 1, "Should find at least one log entry for testlogmem")
+	assert.True(t, buf.Count(`testkey`) == 1, "Should find at least one log entry for testkey")
+	assert.True(t, buf.Count(`testvalue`) == 1, "Should find at least one log entry for testvalue")
+}
+
+func TestThreshold_Exceeded(t *testing.T) {
+	tests := []struct {
+		th        logmem.Threshold
+		prev, cur uint64
+		want      bool
+	}{
+		{logmem.Threshold{}, 0, 1 << 40, false},
+		{logmem.Threshold{GrowthAbs: 10}, 100, 109, false},
+		{logmem.Threshold{GrowthAbs: 10}, 100, 110, true},
+		{logmem.Threshold{GrowthAbs: 10}, 100, 0, false}, // no underflow
+		{logmem.Threshold{ShrinkAbs: 10}, 100, 91, false},
+		{logmem.Threshold{ShrinkAbs: 10}, 100, 90, true},
+		{logmem.Threshold{ShrinkAbs: 10}, 100, 1000, false},
+		{logmem.Threshold{GrowthPercent: 50}, 100, 149, false},
+		{logmem.Threshold{GrowthPercent: 50}, 100, 150, true},
+		{logmem.Threshold{GrowthPercent: 50}, 0, 1, true},
+		{logmem.Threshold{ShrinkPercent: 50}, 100, 51, false},
+		{logmem.Threshold{ShrinkPercent: 50}, 100, 50, true},
+		{logmem.Threshold{GrowthAbs: 1, ShrinkAbs: 1}, 100, 100, false},
+	}
+	for i, test := range tests {
+		assert.Exactly(t, test.want, test.th.Exceeded(test.prev, test.cur), "Index %d", i)
+	}
+}
+
+func TestMetric_String(t *testing.T) {
+	assert.Exactly(t, "heap_alloc", logmem.MetricHeapAlloc.String())
+	assert.Exactly(t, "gc_pause_p99", logmem.MetricGCPauseP99.String())
+	assert.Exactly(t, "Metric(200)", logmem.Metric(200).String())
+}
+
+// startBlocked starts n goroutines which block until the returned release
+// function gets called. release waits until all goroutines have exited,
+// otherwise they leak into the baseline of the next test.
+func startBlocked(n int) (release func()) {
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			<-block
+		}()
+	}
+	return func() {
+		close(block)
+		wg.Wait()
+	}
+}
+
+func TestPeriodicallyWithOptions(t *testing.T) {
+	var buf log.MutexBuffer
+	l := logw.NewLog(
+		logw.WithWriter(&buf),
+		logw.WithLevel(logw.LevelDebug),
+		logw.WithFlag(0),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tr := logmem.NewTracker()
+	p := logmem.PeriodicallyWithOptions(ctx, l, logmem.Options{
+		Interval: 10 * time.Millisecond,
+		Thresholds: map[logmem.Metric]logmem.Threshold{
+			logmem.MetricGoroutines: {GrowthAbs: 50},
+			logmem.MetricGCPauseMax: {},
+		},
+		Message: "[logmem] goroutines",
+		Fields:  log.Fields{log.String("app", "test")},
+		Tracker: tr,
+	})
+
+	release := startBlocked(60)
+	assert.NoError(t, buf.WaitFor(ctx, "[logmem] goroutines"))
+	release()
+
+	p.Stop()
+	p.Stop() // no panic
+	<-p.Done()
+
+	out := buf.String()
+	assert.Contains(t, out, `trigger: "goroutines"`)
+	assert.Contains(t, out, `goroutines: `)
+	assert.Contains(t, out, `gc_pause_max_ms: `)
+	assert.Contains(t, out, `app: "test"`)
+	assert.Contains(t, out, `DEBUG logmem.Periodically.terminated.done error: "context canceled"`)
+	assert.Exactly(t, 1, buf.Count("[logmem] goroutines"))
+
+	last := tr.Last()
+	assert.False(t, last.Time.IsZero(), "The logged Snapshot must be stored in the Tracker")
+	assert.Contains(t, out, fmt.Sprintf(`heap_objects: %d `, last.HeapObjects))
+	assert.Contains(t, out, fmt.Sprintf(`num_gc: %d `, last.NumGC))
+}
+
+func TestPeriodicallyRuntimeMetrics(t *testing.T) {
+	var buf log.MutexBuffer
+	l := logw.NewLog(
+		logw.WithWriter(&buf),
+		logw.WithLevel(logw.LevelDebug),
+		logw.WithFlag(0),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	p, err := logmem.PeriodicallyRuntimeMetrics(ctx, l, logmem.RuntimeMetricsOptions{
+		Interval: 5 * time.Millisecond,
+		Metrics: map[string]logmem.Threshold{
+			"/sched/goroutines:goroutines": {GrowthAbs: 50},
+			"/gc/pauses:seconds":           {},
+		},
+		Fields: log.Fields{log.String("app", "test")},
+	})
+	assert.NoError(t, err)
+
+	release := startBlocked(60)
+	assert.NoError(t, buf.WaitFor(ctx, "[logmem] runtime metrics"))
+	release()
+	p.Stop()
+
+	out := buf.String()
+	assert.Contains(t, out, `trigger: "sched_goroutines_goroutines"`)
+	assert.Regexp(t, `sched_goroutines_goroutines: \d+ diff_sched_goroutines_goroutines: \d+`, out)
+	assert.Contains(t, out, `gc_pauses_seconds_p50: `)
+	assert.Contains(t, out, `diff_gc_pauses_seconds_p99: `)
+	assert.Contains(t, out, `app: "test"`)
+	assert.Contains(t, out, `DEBUG logmem.PeriodicallyRuntimeMetrics.terminated.done error: "context canceled"`)
+}
+
+func TestPeriodicallyRuntimeMetrics_UnknownMetric(t *testing.T) {
+	p, err := logmem.PeriodicallyRuntimeMetrics(context.Background(), logw.NewLog(), logmem.RuntimeMetricsOptions{
+		Metrics: map[string]logmem.Threshold{
+			"/not/existing:bytes": {},
+		},
+	})
+	assert.Nil(t, p)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+
+	// The default metrics must exist.
+	p, err = logmem.PeriodicallyRuntimeMetrics(context.Background(), logw.NewLog(), logmem.RuntimeMetricsOptions{})
+	assert.NoError(t, err)
+	p.Stop()
+}
+
+func TestCaptureProfiles(t *testing.T) {
+	var buf log.MutexBuffer
+	l := logw.NewLog(
+		logw.WithWriter(&buf),
+		logw.WithLevel(logw.LevelInfo),
+		logw.WithFlag(0),
+	)
+	dir := filepath.Join(t.TempDir(), "pprof")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	p, err := logmem.CaptureProfiles(ctx, l, logmem.ProfileOptions{
+		Dir:         dir,
+		Interval:    5 * time.Millisecond,
+		HeapLimit:   1,
+		MinInterval: time.Hour,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, buf.WaitFor(ctx, "[logmem] profiles captured"))
+	time.Sleep(20 * time.Millisecond) // more ticks must be rate limited
+	p.Stop()
+
+	assert.Exactly(t, 1, buf.Count("[logmem] profiles captured"))
+	out := buf.String()
+	assert.Contains(t, out, `trigger: "heap_limit"`)
+	files, err := filepath.Glob(filepath.Join(dir, "logmem-*.pprof"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	for _, f := range files {
+		assert.Contains(t, out, f)
+	}
+	assert.Contains(t, out, `heap_profile: "`+dir)
+	assert.Contains(t, out, `goroutine_profile: "`+dir)
+}
+
+func TestCaptureProfiles_Retention(t *testing.T) {
+	var buf log.MutexBuffer
+	l := logw.NewLog(logw.WithWriter(&buf), logw.WithFlag(0))
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("x"), 0o644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	p, err := logmem.CaptureProfiles(ctx, l, logmem.ProfileOptions{
+		Dir:         dir,
+		Interval:    time.Millisecond,
+		HeapLimit:   1,
+		MinInterval: time.Nanosecond,
+		MaxCaptures: 2,
+		Profiles:    []string{"goroutine"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, buf.WaitForN(ctx, "[logmem] profiles captured", 5))
+	p.Stop()
+
+	files, err := filepath.Glob(filepath.Join(dir, "logmem-*-goroutine.pprof"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.NotContains(t, buf.String(), "error")
+	_, err = os.Stat(filepath.Join(dir, "other.txt"))
+	assert.NoError(t, err)
+}
+
+func TestCaptureProfiles_Errors(t *testing.T) {
+	_, err := logmem.CaptureProfiles(context.Background(), logw.NewLog(), logmem.ProfileOptions{})
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+
+	_, err = logmem.CaptureProfiles(context.Background(), logw.NewLog(), logmem.ProfileOptions{
+		Dir:      t.TempDir(),
+		Profiles: []string{"cpu"},
+	})
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
 }
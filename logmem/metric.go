@@ -0,0 +1,170 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/corestoreio/log"
+)
+
+// Metric selects a runtime value which gets observed by Periodic.
+type Metric uint8
+
+// Metric* constants define the observable values. Byte values are checked
+// in bytes and pauses in nanoseconds.
+const (
+	MetricHeapAlloc Metric = iota + 1
+	MetricSys
+	MetricHeapObjects
+	MetricStackInuse
+	MetricGoroutines
+	// MetricGCPause* are calculated over the last 256 garbage collections.
+	MetricGCPauseP50
+	MetricGCPauseP95
+	MetricGCPauseP99
+	MetricGCPauseMax
+)
+
+var metricNames = [...]string{
+	MetricHeapAlloc:   "heap_alloc",
+	MetricSys:         "sys",
+	MetricHeapObjects: "heap_objects",
+	MetricStackInuse:  "stack_inuse",
+	MetricGoroutines:  "goroutines",
+	MetricGCPauseP50:  "gc_pause_p50",
+	MetricGCPauseP95:  "gc_pause_p95",
+	MetricGCPauseP99:  "gc_pause_p99",
+	MetricGCPauseMax:  "gc_pause_max",
+}
+
+func (m Metric) String() string {
+	if int(m) < len(metricNames) && metricNames[m] != "" {
+		return metricNames[m]
+	}
+	return fmt.Sprintf("Metric(%d)", uint8(m))
+}
+
+// Threshold defines which change of a metric, compared to the last logged
+// value, triggers a log entry. A zero field disables its check.
+type Threshold struct {
+	// GrowthAbs triggers if the value has grown by at least GrowthAbs.
+	GrowthAbs uint64
+	// ShrinkAbs triggers if the value has shrunk by at least ShrinkAbs.
+	ShrinkAbs uint64
+	// GrowthPercent triggers if the value has grown by at least GrowthPercent
+	// percent. A growth from zero counts as infinite.
+	GrowthPercent float64
+	// ShrinkPercent triggers if the value has shrunk by at least ShrinkPercent
+	// percent.
+	ShrinkPercent float64
+}
+
+// Exceeded reports whether the change from prev to cur reaches one of the
+// limits.
+func (t Threshold) Exceeded(prev, cur uint64) bool {
+	switch {
+	case cur > prev:
+		diff := cur - prev
+		return (t.GrowthAbs > 0 && diff >= t.GrowthAbs) ||
+			(t.GrowthPercent > 0 && (prev == 0 || float64(diff)/float64(prev)*100 >= t.GrowthPercent))
+	case cur < prev:
+		diff := prev - cur
+		return (t.ShrinkAbs > 0 && diff >= t.ShrinkAbs) ||
+			(t.ShrinkPercent > 0 && float64(diff)/float64(prev)*100 >= t.ShrinkPercent)
+	}
+	return false
+}
+
+// snapshot contains all values from which the metrics get read.
+type snapshot struct {
+	mem        runtime.MemStats
+	goroutines int
+	pauses     []uint64 // sorted, nil if not requested
+}
+
+func readSnapshot(s *snapshot, withPauses bool) {
+	runtime.ReadMemStats(&s.mem)
+	s.goroutines = runtime.NumGoroutine()
+	s.pauses = s.pauses[:0]
+	if !withPauses {
+		return
+	}
+	n := int(s.mem.NumGC)
+	if n > len(s.mem.PauseNs) {
+		n = len(s.mem.PauseNs)
+	}
+	// PauseNs is a circular buffer, the most recent pause is at
+	// PauseNs[(NumGC+255)%256].
+	for i := 0; i < n; i++ {
+		s.pauses = append(s.pauses, s.mem.PauseNs[(int(s.mem.NumGC)-1-i+len(s.mem.PauseNs))%len(s.mem.PauseNs)])
+	}
+	sort.Slice(s.pauses, func(i, j int) bool { return s.pauses[i] < s.pauses[j] })
+}
+
+func (s *snapshot) value(m Metric) uint64 {
+	switch m {
+	case MetricHeapAlloc:
+		return s.mem.HeapAlloc
+	case MetricSys:
+		return s.mem.Sys
+	case MetricHeapObjects:
+		return s.mem.HeapObjects
+	case MetricStackInuse:
+		return s.mem.StackInuse
+	case MetricGoroutines:
+		return uint64(s.goroutines)
+	case MetricGCPauseP50:
+		return quantile(s.pauses, 0.50)
+	case MetricGCPauseP95:
+		return quantile(s.pauses, 0.95)
+	case MetricGCPauseP99:
+		return quantile(s.pauses, 0.99)
+	case MetricGCPauseMax:
+		return quantile(s.pauses, 1)
+	}
+	return 0
+}
+
+// quantile returns the nearest-rank quantile q of the sorted values.
+func quantile(sorted []uint64, q float64) uint64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// field returns the log field of a metric which is not part of the default
+// memory fields, see logMemoryStats.
+func (m Metric) field(s *snapshot) (log.Field, bool) {
+	switch m {
+	case MetricStackInuse:
+		return log.Float64("stack_inuse_mb", ToMB(s.mem.StackInuse)), true
+	case MetricGoroutines:
+		return log.Int("goroutines", s.goroutines), true
+	case MetricGCPauseP50, MetricGCPauseP95, MetricGCPauseP99, MetricGCPauseMax:
+		return log.Float64(m.String()+"_ms", float64(s.value(m))/1e6), true
+	}
+	return nil, false
+}
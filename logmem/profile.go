@@ -0,0 +1,224 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+const (
+	profilePrefix = "logmem-"
+	profileSuffix = ".pprof"
+	// profileTimeFormat sorts lexically.
+	profileTimeFormat = "20060102T150405.000000000Z"
+	heapMetric        = "/memory/classes/heap/objects:bytes"
+)
+
+// ProfileOptions configures CaptureProfiles.
+type ProfileOptions struct {
+	// Dir gets created if it does not exist. Required.
+	Dir string
+	// Interval between two heap samples. Defaults to ten seconds.
+	Interval time.Duration
+	// HeapLimit captures the profiles while the heap in use is equal or above
+	// the limit in bytes. Zero disables the check.
+	HeapLimit uint64
+	// GrowthPercent captures the profiles if the heap in use has grown by at
+	// least GrowthPercent percent between two samples. Zero disables the
+	// check.
+	GrowthPercent float64
+	// MinInterval defines the minimum duration between two captures.
+	// Defaults to five minutes.
+	MinInterval time.Duration
+	// MaxCaptures defines how many captures are kept in Dir. Older files get
+	// removed. Defaults to ten.
+	MaxCaptures int
+	// Profiles contains the names of the runtime/pprof profiles. Defaults to
+	// "heap" and "goroutine".
+	Profiles []string
+	// Message of the log entry. Defaults to "[logmem] profiles captured".
+	Message string
+	// Fields get added to each log entry.
+	Fields log.Fields
+}
+
+// CaptureProfiles samples the heap in use and writes pprof profiles into a
+// directory once the heap exceeds the limit or grows too fast, so the
+// evidence of a memory spike does not get lost. Each capture gets logged with
+// the paths of the profiles, for example heap_profile and goroutine_profile.
+// Failed captures get logged with the error. The heap gets read from
+// runtime/metrics, which does not stop the world.
+//
+//	p, err := logmem.CaptureProfiles(ctx, l, logmem.ProfileOptions{
+//		Dir:           "/var/log/app/pprof",
+//		HeapLimit:     2 << 30,
+//		GrowthPercent: 50,
+//	})
+func CaptureProfiles(ctx context.Context, l log.Logger, o ProfileOptions) (*Periodic, error) {
+	if o.Dir == "" {
+		return nil, errors.NotValid.Newf("[logmem] ProfileOptions.Dir cannot be empty")
+	}
+	if o.Interval <= 0 {
+		o.Interval = 10 * time.Second
+	}
+	if o.MinInterval <= 0 {
+		o.MinInterval = 5 * time.Minute
+	}
+	if o.MaxCaptures <= 0 {
+		o.MaxCaptures = 10
+	}
+	if o.Profiles == nil {
+		o.Profiles = []string{"heap", "goroutine"}
+	}
+	if o.Message == "" {
+		o.Message = "[logmem] profiles captured"
+	}
+	for _, name := range o.Profiles {
+		if pprof.Lookup(name) == nil {
+			return nil, errors.NotFound.Newf("[logmem] Unknown pprof profile %q", name)
+		}
+	}
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "[logmem] Failed to create directory %q", o.Dir)
+	}
+
+	sample := []metrics.Sample{{Name: heapMetric}}
+	readHeap := func() uint64 {
+		metrics.Read(sample)
+		return sample[0].Value.Uint64()
+	}
+	growth := Threshold{GrowthPercent: o.GrowthPercent}
+	prev := readHeap()
+
+	return NewPeriodic(ctx, func(ctx context.Context) {
+		tick := time.NewTicker(o.Interval)
+		defer tick.Stop()
+		var lastCapture time.Time
+		for {
+			select {
+			case <-tick.C:
+				cur := readHeap()
+				var trigger string
+				switch {
+				case o.HeapLimit > 0 && cur >= o.HeapLimit:
+					trigger = "heap_limit"
+				case growth.Exceeded(prev, cur):
+					trigger = "heap_growth"
+				}
+				prevHeap := prev
+				prev = cur
+				now := log.Now()
+				if trigger == "" || (!lastCapture.IsZero() && now.Sub(lastCapture) < o.MinInterval) {
+					continue
+				}
+				lastCapture = now
+
+				fields := log.Fields{
+					log.String("trigger", trigger),
+					log.Float64("heap_mb", ToMB(cur)),
+					log.Float64("diff_heap_mb", DiffMB(prevHeap, cur)),
+				}
+				paths, err := writeProfiles(o.Dir, now, o.Profiles)
+				for i, path := range paths {
+					fields = append(fields, log.String(o.Profiles[i]+"_profile", path))
+				}
+				if err == nil {
+					err = removeOldProfiles(o.Dir, o.MaxCaptures)
+				}
+				if err != nil {
+					fields = append(fields, log.Err(err))
+				}
+				if l.IsInfo() {
+					l.Info(o.Message, append(fields, o.Fields...)...)
+				}
+			case <-ctx.Done():
+				if l.IsDebug() {
+					l.Debug("logmem.CaptureProfiles.terminated.done", log.Err(ctx.Err()))
+				}
+				return
+			}
+		}
+	}), nil
+}
+
+// writeProfiles writes the profiles into dir and returns the paths of the
+// written files.
+func writeProfiles(dir string, now time.Time, profiles []string) ([]string, error) {
+	ts := now.UTC().Format(profileTimeFormat)
+	paths := make([]string, 0, len(profiles))
+	for _, name := range profiles {
+		path := filepath.Join(dir, profilePrefix+ts+"-"+name+profileSuffix)
+		f, err := os.Create(path)
+		if err != nil {
+			return paths, errors.Wrapf(err, "[logmem] Failed to create profile %q", path)
+		}
+		err = pprof.Lookup(name).WriteTo(f, 0)
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			return paths, errors.Wrapf(err, "[logmem] Failed to write profile %q", path)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// removeOldProfiles keeps the files of the newest maxCaptures captures.
+func removeOldProfiles(dir string, maxCaptures int) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "[logmem] Failed to read directory %q", dir)
+	}
+	captures := map[string][]string{}
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, profilePrefix) || !strings.HasSuffix(name, profileSuffix) {
+			continue
+		}
+		ts := name[len(profilePrefix):]
+		if i := strings.IndexByte(ts, '-'); i > 0 {
+			ts = ts[:i]
+		}
+		captures[ts] = append(captures[ts], name)
+	}
+	if len(captures) <= maxCaptures {
+		return nil
+	}
+	timestamps := make([]string, 0, len(captures))
+	for ts := range captures {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Strings(timestamps)
+	for _, ts := range timestamps[:len(timestamps)-maxCaptures] {
+		for _, name := range captures[ts] {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "[logmem] Failed to remove profile %q", name)
+			}
+		}
+	}
+	return nil
+}
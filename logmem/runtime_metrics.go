@@ -0,0 +1,299 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// RuntimeMetricsOptions configures PeriodicallyRuntimeMetrics.
+type RuntimeMetricsOptions struct {
+	// Interval between two checks. Defaults to one minute.
+	Interval time.Duration
+	// Metrics maps the names of runtime/metrics, like "/gc/heap/live:bytes",
+	// to their thresholds. A zero Threshold logs the metric without
+	// triggering. Float64 values and histogram quantiles get compared in
+	// units of 1e-9, so seconds become nanoseconds. Defaults to 10% growth or
+	// shrink of "/memory/classes/heap/objects:bytes" and
+	// "/memory/classes/total:bytes".
+	Metrics map[string]Threshold
+	// Quantiles summarise histograms like "/gc/pauses:seconds". The quantiles
+	// get calculated over the observations of the last interval only. Without
+	// observations, a quantile is zero. Defaults to 0.5 and 0.99.
+	Quantiles []float64
+	// Message of the log entry. Defaults to "[logmem] runtime metrics".
+	Message string
+	// Fields get added to each log entry.
+	Fields log.Fields
+}
+
+// series is a single observed value. A histogram creates one series per
+// quantile.
+type series struct {
+	key      string
+	index    int // of the sample
+	quantile float64
+	th       Threshold
+}
+
+// seriesValue holds either an uint64 or a float64.
+type seriesValue struct {
+	isFloat bool
+	u       uint64
+	f       float64
+}
+
+// cmp returns the value for the threshold comparison.
+func (v seriesValue) cmp() uint64 {
+	if !v.isFloat {
+		return v.u
+	}
+	if v.f <= 0 || math.IsNaN(v.f) {
+		return 0
+	}
+	if v.f >= math.MaxUint64/1e9 {
+		return math.MaxUint64
+	}
+	return uint64(math.Round(v.f * 1e9))
+}
+
+// PeriodicallyRuntimeMetrics logs the selected runtime/metrics each time a
+// metric exceeds its threshold, compared to the last logged values. Unlike
+// runtime.ReadMemStats, reading runtime/metrics does not stop the world, so it
+// can run at a high frequency. Each metric gets logged with its value and the
+// difference to the last entry, the key derives from the name:
+// "/sched/goroutines:goroutines" becomes "sched_goroutines_goroutines" and
+// "diff_sched_goroutines_goroutines". An unknown metric name returns a
+// NotFound error. If Info level in the logger has been disabled, no logging
+// will happen. Debug level logs the termination of the goroutine.
+//
+//	p, err := logmem.PeriodicallyRuntimeMetrics(ctx, l, logmem.RuntimeMetricsOptions{
+//		Interval: time.Second,
+//		Metrics: map[string]logmem.Threshold{
+//			"/gc/heap/live:bytes":          {GrowthPercent: 20},
+//			"/sched/goroutines:goroutines": {GrowthAbs: 1000},
+//			"/gc/pauses:seconds":           {GrowthAbs: uint64(time.Millisecond)},
+//		},
+//	})
+func PeriodicallyRuntimeMetrics(ctx context.Context, l log.Logger, o RuntimeMetricsOptions) (*Periodic, error) {
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Metrics == nil {
+		o.Metrics = map[string]Threshold{
+			"/memory/classes/heap/objects:bytes": {GrowthPercent: 10, ShrinkPercent: 10},
+			"/memory/classes/total:bytes":        {GrowthPercent: 10, ShrinkPercent: 10},
+		}
+	}
+	if o.Quantiles == nil {
+		o.Quantiles = []float64{0.5, 0.99}
+	}
+	if o.Message == "" {
+		o.Message = "[logmem] runtime metrics"
+	}
+
+	rr, err := newRuntimeReader(o.Metrics, o.Quantiles)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ss := rr.series
+
+	prev := make([]seriesValue, len(ss))
+	cur := make([]seriesValue, len(ss))
+	rr.read(prev)
+
+	return NewPeriodic(ctx, func(ctx context.Context) {
+		tick := time.NewTicker(o.Interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if !l.IsInfo() {
+					continue
+				}
+				rr.read(cur)
+				var triggered []string
+				for i, s := range ss {
+					if s.th.Exceeded(prev[i].cmp(), cur[i].cmp()) {
+						triggered = append(triggered, s.key)
+					}
+				}
+				if len(triggered) == 0 {
+					continue
+				}
+				fields := make(log.Fields, 0, 1+2*len(ss)+len(o.Fields))
+				fields = append(fields, log.Strings("trigger", triggered...))
+				for i, s := range ss {
+					if cur[i].isFloat {
+						fields = append(fields,
+							log.Float64(s.key, cur[i].f),
+							log.Float64("diff_"+s.key, cur[i].f-prev[i].f),
+						)
+						continue
+					}
+					fields = append(fields,
+						log.Uint64(s.key, cur[i].u),
+						log.Int64("diff_"+s.key, Diff(prev[i].u, cur[i].u)),
+					)
+				}
+				l.Info(o.Message, append(fields, o.Fields...)...)
+				prev, cur = cur, prev
+			case <-ctx.Done():
+				if l.IsDebug() {
+					l.Debug("logmem.PeriodicallyRuntimeMetrics.terminated.done", log.Err(ctx.Err()))
+				}
+				return
+			}
+		}
+	}), nil
+}
+
+// runtimeReader reads the samples and converts them into series values.
+type runtimeReader struct {
+	samples []metrics.Sample
+	series  []series
+	// hists contains the previous counts of each histogram sample, nil for
+	// other kinds.
+	hists []*histogramDiff
+}
+
+// newRuntimeReader validates the metric names and creates the samples and the
+// series sorted by name.
+func newRuntimeReader(thresholds map[string]Threshold, quantiles []float64) (*runtimeReader, error) {
+	kinds := make(map[string]metrics.ValueKind, len(thresholds))
+	for _, d := range metrics.All() {
+		kinds[d.Name] = d.Kind
+	}
+
+	names := make([]string, 0, len(thresholds))
+	for name := range thresholds {
+		kind, ok := kinds[name]
+		if !ok || kind == metrics.KindBad {
+			return nil, errors.NotFound.Newf("[logmem] Unknown runtime metric %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rr := &runtimeReader{
+		samples: make([]metrics.Sample, len(names)),
+		hists:   make([]*histogramDiff, len(names)),
+	}
+	for i, name := range names {
+		rr.samples[i].Name = name
+		key := metricKey(name)
+		if kinds[name] != metrics.KindFloat64Histogram {
+			rr.series = append(rr.series, series{key: key, index: i, th: thresholds[name]})
+			continue
+		}
+		rr.hists[i] = new(histogramDiff)
+		for _, q := range quantiles {
+			rr.series = append(rr.series, series{
+				key:      key + "_p" + strings.Replace(strconv.FormatFloat(q*100, 'f', -1, 64), ".", "", 1),
+				index:    i,
+				quantile: q,
+				th:       thresholds[name],
+			})
+		}
+	}
+	return rr, nil
+}
+
+// metricKey converts "/gc/heap/live:bytes" into "gc_heap_live_bytes".
+func metricKey(name string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "-", "_", "*", "").Replace(strings.TrimPrefix(name, "/"))
+}
+
+// read reads the samples and stores the values of the series in dst. The
+// histograms get summarised immediately because metrics.Read can reuse their
+// memory. The quantiles cover the observations since the previous read.
+func (rr *runtimeReader) read(dst []seriesValue) {
+	metrics.Read(rr.samples)
+	for i, hd := range rr.hists {
+		if hd != nil {
+			hd.update(rr.samples[i].Value.Float64Histogram())
+		}
+	}
+	for i, s := range rr.series {
+		v := rr.samples[s.index].Value
+		switch v.Kind() {
+		case metrics.KindUint64:
+			dst[i] = seriesValue{u: v.Uint64()}
+		case metrics.KindFloat64:
+			dst[i] = seriesValue{isFloat: true, f: v.Float64()}
+		case metrics.KindFloat64Histogram:
+			dst[i] = seriesValue{isFloat: true, f: rr.hists[s.index].quantile(s.quantile)}
+		}
+	}
+}
+
+// histogramDiff tracks the cumulative counts of a histogram to provide the
+// counts observed between two updates.
+type histogramDiff struct {
+	prev    []uint64
+	delta   []uint64
+	buckets []float64
+}
+
+// update stores the difference between the counts of h and the counts of the
+// previous update. The first update uses all counts of h.
+func (hd *histogramDiff) update(h *metrics.Float64Histogram) {
+	if len(hd.prev) != len(h.Counts) {
+		hd.prev = make([]uint64, len(h.Counts))
+		hd.delta = make([]uint64, len(h.Counts))
+	}
+	for i, c := range h.Counts {
+		hd.delta[i] = c - hd.prev[i]
+		hd.prev[i] = c
+	}
+	hd.buckets = append(hd.buckets[:0], h.Buckets...)
+}
+
+// quantile returns the upper bound of the bucket which contains the quantile
+// q of the counts observed between the last two updates. Infinite bounds get
+// replaced by the finite bound of the bucket.
+func (hd *histogramDiff) quantile(q float64) float64 {
+	var total uint64
+	for _, c := range hd.delta {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cum uint64
+	for i, c := range hd.delta {
+		cum += c
+		if cum >= rank {
+			if upper := hd.buckets[i+1]; !math.IsInf(upper, 0) {
+				return upper
+			}
+			return hd.buckets[i]
+		}
+	}
+	return hd.buckets[len(hd.buckets)-1]
+}
@@ -0,0 +1,46 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem
+
+import (
+	"math"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestHistogramDiff(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 3, math.Inf(1)}
+	hd := new(histogramDiff)
+
+	// The first update covers all observations since the program start.
+	hd.update(&metrics.Float64Histogram{Counts: []uint64{0, 100, 0, 0}, Buckets: buckets})
+	assert.Exactly(t, 2.0, hd.quantile(0.5))
+	assert.Exactly(t, 2.0, hd.quantile(0.99))
+
+	// Only the observations of the last interval count.
+	hd.update(&metrics.Float64Histogram{Counts: []uint64{0, 100, 0, 10}, Buckets: buckets})
+	assert.Exactly(t, 3.0, hd.quantile(0.5))
+	assert.Exactly(t, 3.0, hd.quantile(0.99))
+
+	hd.update(&metrics.Float64Histogram{Counts: []uint64{0, 100, 0, 10}, Buckets: buckets})
+	assert.Exactly(t, 0.0, hd.quantile(0.5), "No observations")
+
+	hd.update(&metrics.Float64Histogram{Counts: []uint64{1, 101, 8, 10}, Buckets: buckets})
+	assert.Exactly(t, 1.0, hd.quantile(0), "Infinite lower bound")
+	assert.Exactly(t, 3.0, hd.quantile(0.5))
+	assert.Exactly(t, 3.0, hd.quantile(1))
+}
@@ -0,0 +1,184 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/log"
+)
+
+// Snapshot contains the memory statistic as logged by Now and Periodically,
+// including the differences to a previous state. The JSON names equal the log
+// keys.
+type Snapshot struct {
+	Time                time.Time `json:"time"`
+	AllocMB             float64   `json:"alloc_mb"`
+	HeapAllocMB         float64   `json:"heap_alloc_mb"`
+	HeapObjects         uint64    `json:"heap_objects"`
+	SysMB               float64   `json:"sys_mb"`
+	NumberOfLiveObjects uint64    `json:"number_of_live_objects"`
+	NumGC               uint32    `json:"num_gc"`
+
+	DiffAllocMB             float64 `json:"diff_alloc_mb"`
+	DiffHeapAllocMB         float64 `json:"diff_heap_alloc_mb"`
+	DiffHeapObjects         int64   `json:"diff_heap_objects"`
+	DiffSysMB               float64 `json:"diff_sys_mb"`
+	DiffNumberOfLiveObjects int64   `json:"diff_number_of_live_objects"`
+}
+
+// NewSnapshot computes the Snapshot of cur and its differences to prev. prev
+// can be nil to get the differences to zero.
+func NewSnapshot(prev, cur *runtime.MemStats) Snapshot {
+	if prev == nil {
+		prev = new(runtime.MemStats)
+	}
+	nolo := liveObjects(cur)
+	return Snapshot{
+		Time:                log.Now(),
+		AllocMB:             ToMB(cur.Alloc),
+		HeapAllocMB:         ToMB(cur.HeapAlloc),
+		HeapObjects:         cur.HeapObjects,
+		SysMB:               ToMB(cur.Sys),
+		NumberOfLiveObjects: nolo,
+		NumGC:               cur.NumGC,
+
+		DiffAllocMB:             DiffMB(prev.Alloc, cur.Alloc),
+		DiffHeapAllocMB:         DiffMB(prev.HeapAlloc, cur.HeapAlloc),
+		DiffHeapObjects:         Diff(prev.HeapObjects, cur.HeapObjects),
+		DiffSysMB:               DiffMB(prev.Sys, cur.Sys),
+		DiffNumberOfLiveObjects: Diff(liveObjects(prev), nolo),
+	}
+}
+
+func liveObjects(ms *runtime.MemStats) uint64 {
+	nolo := ms.Mallocs - ms.Frees
+	if nolo > math.MaxUint64-ms.Mallocs { // check overflow
+		nolo = 0
+	}
+	return nolo
+}
+
+// fields returns the log fields without the time, which gets added by the
+// logger.
+func (s Snapshot) fields() log.Fields {
+	// Add more fields if desired.
+	return log.Fields{
+		log.Float64("alloc_mb", s.AllocMB),
+		log.Float64("heap_alloc_mb", s.HeapAllocMB),
+		log.Uint64("heap_objects", s.HeapObjects),
+		log.Float64("sys_mb", s.SysMB),
+		log.Uint64("number_of_live_objects", s.NumberOfLiveObjects),
+		log.Uint("num_gc", uint(s.NumGC)),
+
+		log.Float64("diff_alloc_mb", s.DiffAllocMB),
+		log.Float64("diff_heap_alloc_mb", s.DiffHeapAllocMB),
+		log.Int64("diff_heap_objects", s.DiffHeapObjects),
+		log.Float64("diff_sys_mb", s.DiffSysMB),
+		log.Int64("diff_number_of_live_objects", s.DiffNumberOfLiveObjects),
+	}
+}
+
+// MarshalLog implements log.Marshaler.
+//
+//	l.Info("memory", log.Marshal("mem", logmem.DefaultTracker.Current()))
+func (s Snapshot) MarshalLog(kv log.KeyValuer) error {
+	return s.fields().AddTo(kv)
+}
+
+// Tracker computes Snapshots with the differences to its previous Snapshot
+// call. A Tracker is safe for concurrent use.
+type Tracker struct {
+	mu   sync.Mutex
+	prev runtime.MemStats
+	last Snapshot
+}
+
+// DefaultTracker gets used by Now and by default by Periodically.
+var DefaultTracker = NewTracker()
+
+// NewTracker creates a new Tracker. The first Snapshot reports the
+// differences to zero.
+func NewTracker() *Tracker {
+	return new(Tracker)
+}
+
+// Snapshot reads the memory statistic and stores it as the state for the
+// differences of the next call. runtime.ReadMemStats stops the world.
+func (t *Tracker) Snapshot() Snapshot {
+	var cur runtime.MemStats
+	runtime.ReadMemStats(&cur)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = NewSnapshot(&t.prev, &cur)
+	t.prev = cur
+	return t.last
+}
+
+// store sets the Snapshot of cur as the result of the last call, like
+// Snapshot does with its own reading.
+func (t *Tracker) store(prev, cur *runtime.MemStats) Snapshot {
+	s := NewSnapshot(prev, cur)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = s
+	t.prev = *cur
+	return s
+}
+
+// Current reads the memory statistic with the differences to the last
+// Snapshot call without changing the state, so scrapers do not disturb the
+// differences of the log entries.
+func (t *Tracker) Current() Snapshot {
+	var cur runtime.MemStats
+	runtime.ReadMemStats(&cur)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return NewSnapshot(&t.prev, &cur)
+}
+
+// Last returns the result of the last Snapshot call. The zero value if
+// Snapshot has not yet been called.
+func (t *Tracker) Last() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+// Publish exports Current under the name in the expvar package, available at
+// /debug/vars. Like expvar.Publish it panics if the name is already in use.
+func (t *Tracker) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return t.Current()
+	}))
+}
+
+// ServeHTTP writes Current as JSON.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(t.Current())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(append(data, '\n'))
+}
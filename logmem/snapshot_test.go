@@ -0,0 +1,94 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmem_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logmem"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ log.Marshaler = logmem.Snapshot{}
+
+func TestNewSnapshot(t *testing.T) {
+	prev := runtime.MemStats{
+		Alloc:       4 << 20,
+		HeapAlloc:   4 << 20,
+		HeapObjects: 300,
+		Sys:         16 << 20,
+		Mallocs:     1000,
+		Frees:       400,
+	}
+	cur := runtime.MemStats{
+		Alloc:       3 << 20,
+		HeapAlloc:   3 << 20,
+		HeapObjects: 100,
+		Sys:         32 << 20,
+		Mallocs:     1200,
+		Frees:       1000,
+		NumGC:       3,
+	}
+	s := logmem.NewSnapshot(&prev, &cur)
+	assert.Exactly(t, 3.0, s.HeapAllocMB)
+	assert.Exactly(t, uint64(200), s.NumberOfLiveObjects)
+	assert.Exactly(t, -1.0, s.DiffAllocMB)
+	assert.Exactly(t, int64(-200), s.DiffHeapObjects)
+	assert.Exactly(t, 16.0, s.DiffSysMB)
+	assert.Exactly(t, int64(-400), s.DiffNumberOfLiveObjects)
+
+	assert.Exactly(t,
+		"alloc_mb: 3 heap_alloc_mb: 3 heap_objects: 100 sys_mb: 32 number_of_live_objects: 200 num_gc: 3 diff_alloc_mb: -1 diff_heap_alloc_mb: -1 diff_heap_objects: -200 diff_sys_mb: 16 diff_number_of_live_objects: -400\n",
+		log.Fields{log.Marshal("mem", s)}.ToString("")[1:])
+
+	s = logmem.NewSnapshot(nil, &cur)
+	assert.Exactly(t, int64(100), s.DiffHeapObjects)
+}
+
+func TestTracker(t *testing.T) {
+	tr := logmem.NewTracker()
+	assert.Exactly(t, logmem.Snapshot{}, tr.Last())
+
+	first := tr.Snapshot()
+	assert.Exactly(t, first, tr.Last())
+	assert.Exactly(t, int64(first.HeapObjects), first.DiffHeapObjects, "first Snapshot diffs to zero")
+
+	cur := tr.Current()
+	assert.Exactly(t, first, tr.Last(), "Current must not change the state")
+	assert.True(t, cur.DiffHeapObjects != int64(cur.HeapObjects) || cur.HeapObjects == 0, "Current diffs to the last Snapshot")
+
+	rec := httptest.NewRecorder()
+	tr.ServeHTTP(rec, httptest.NewRequest("GET", "/memory", nil))
+	assert.Exactly(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Contains(t, got, "heap_alloc_mb")
+	assert.Contains(t, got, "diff_number_of_live_objects")
+	assert.Exactly(t, first, tr.Last())
+
+	if expvar.Get("logmem_test_tracker") == nil { // with -count > 1
+		tr.Publish("logmem_test_tracker")
+	}
+	v := expvar.Get("logmem_test_tracker")
+	assert.NotNil(t, v)
+	got = nil
+	assert.NoError(t, json.Unmarshal([]byte(v.String()), &got))
+	assert.Contains(t, got, "sys_mb")
+}
@@ -0,0 +1,397 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logproc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logmem"
+)
+
+// DefaultRoot defines the mount point of the proc file system.
+const DefaultRoot = "/proc"
+
+// DefaultClockTicks defines the USER_HZ of nearly all Linux systems, the unit
+// of the CPU times in /proc/self/stat.
+const DefaultClockTicks = 100
+
+// Stats contains the resources of a process.
+type Stats struct {
+	// FDs is the number of open file descriptors and FDLimit their soft
+	// limit, zero if unlimited.
+	FDs     uint64
+	FDLimit uint64
+	Threads uint64
+	// RSS is the resident set size in bytes.
+	RSS                    uint64
+	VoluntaryCtxSwitches   uint64
+	InvoluntaryCtxSwitches uint64
+	UserTime               time.Duration
+	SystemTime             time.Duration
+	// ReadBytes and WriteBytes have been fetched from or sent to the storage
+	// layer. Both are zero if /proc/self/io cannot be read, which happens in
+	// some containers.
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// FDPercent returns the open file descriptors in percent of the limit, zero
+// if unlimited.
+func (s Stats) FDPercent() float64 {
+	if s.FDLimit == 0 {
+		return 0
+	}
+	return math.Round(float64(s.FDs)/float64(s.FDLimit)*100*100) / 100
+}
+
+// Read reads the resources of the current process from root/self, where root
+// defaults to DefaultRoot. clockTicks converts the CPU times, zero uses
+// DefaultClockTicks.
+func Read(root string, clockTicks int) (s Stats, err error) {
+	if root == "" {
+		root = DefaultRoot
+	}
+	if clockTicks <= 0 {
+		clockTicks = DefaultClockTicks
+	}
+	dir := filepath.Join(root, "self")
+
+	if s.FDs, err = countFDs(filepath.Join(dir, "fd")); err != nil {
+		return s, errors.WithStack(err)
+	}
+	if s.FDLimit, err = readFDLimit(filepath.Join(dir, "limits")); err != nil {
+		return s, errors.WithStack(err)
+	}
+
+	status, err := readKeyValues(filepath.Join(dir, "status"), ':')
+	if err != nil {
+		return s, errors.WithStack(err)
+	}
+	s.Threads = status["Threads"]
+	s.RSS = status["VmRSS"] * 1024 // kB
+	s.VoluntaryCtxSwitches = status["voluntary_ctxt_switches"]
+	s.InvoluntaryCtxSwitches = status["nonvoluntary_ctxt_switches"]
+
+	utime, stime, err := readCPUTimes(filepath.Join(dir, "stat"))
+	if err != nil {
+		return s, errors.WithStack(err)
+	}
+	s.UserTime = time.Duration(utime) * time.Second / time.Duration(clockTicks)
+	s.SystemTime = time.Duration(stime) * time.Second / time.Duration(clockTicks)
+
+	ioStats, err := readKeyValues(filepath.Join(dir, "io"), ':')
+	switch {
+	case err == nil:
+		s.ReadBytes = ioStats["read_bytes"]
+		s.WriteBytes = ioStats["write_bytes"]
+	case !os.IsNotExist(errors.Cause(err)) && !os.IsPermission(errors.Cause(err)):
+		return s, errors.WithStack(err)
+	}
+	return s, nil
+}
+
+// countFDs returns the number of entries in the fd directory. The live
+// directory lists also the descriptor which has been opened to read it, that
+// entry points to the directory itself and does not get counted.
+func countFDs(dir string) (uint64, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "[logproc] Failed to read the file descriptors in %q", dir)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, errors.Wrapf(err, "[logproc] Failed to read the file descriptors in %q", dir)
+	}
+	n := uint64(len(names))
+	dirInfo, err := f.Stat()
+	if err != nil {
+		return 0, errors.Wrapf(err, "[logproc] Failed to stat %q", dir)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, strconv.FormatUint(uint64(f.Fd()), 10))); err == nil && os.SameFile(dirInfo, fi) {
+		n--
+	}
+	return n, nil
+}
+
+// readKeyValues parses lines of "key<sep> value [unit]". Values which are not
+// numbers get skipped.
+func readKeyValues(file string, sep byte) (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[logproc] Failed to read %q", file)
+	}
+	kv := map[string]uint64{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Bytes()
+		i := bytes.IndexByte(line, sep)
+		if i < 0 {
+			continue
+		}
+		fs := bytes.Fields(line[i+1:])
+		if len(fs) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(string(fs[0]), 10, 64); err == nil {
+			kv[string(line[:i])] = v
+		}
+	}
+	return kv, nil
+}
+
+// readFDLimit reads the soft limit of "Max open files".
+func readFDLimit(file string) (uint64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, errors.Wrapf(err, "[logproc] Failed to read %q", file)
+	}
+	const prefix = "Max open files"
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Bytes()
+		if !bytes.HasPrefix(line, []byte(prefix)) {
+			continue
+		}
+		fs := bytes.Fields(line[len(prefix):])
+		if len(fs) == 0 || string(fs[0]) == "unlimited" {
+			return 0, nil
+		}
+		v, err := strconv.ParseUint(string(fs[0]), 10, 64)
+		if err != nil {
+			return 0, errors.NotValid.New(err, "[logproc] Failed to parse %q in %q", prefix, file)
+		}
+		return v, nil
+	}
+	return 0, nil
+}
+
+// readCPUTimes reads utime and stime, the fields 14 and 15 of the stat file.
+// The command name in parentheses can contain spaces, so the fields get
+// counted after the closing parenthesis, which is followed by field 3.
+func readCPUTimes(file string) (utime, stime uint64, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "[logproc] Failed to read %q", file)
+	}
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, 0, errors.NotValid.Newf("[logproc] Invalid format of %q", file)
+	}
+	fs := bytes.Fields(data[i+1:])
+	if len(fs) < 13 {
+		return 0, 0, errors.NotValid.Newf("[logproc] Invalid format of %q", file)
+	}
+	if utime, err = strconv.ParseUint(string(fs[11]), 10, 64); err != nil {
+		return 0, 0, errors.NotValid.New(err, "[logproc] Failed to parse utime in %q", file)
+	}
+	if stime, err = strconv.ParseUint(string(fs[12]), 10, 64); err != nil {
+		return 0, 0, errors.NotValid.New(err, "[logproc] Failed to parse stime in %q", file)
+	}
+	return utime, stime, nil
+}
+
+// Metric selects a value of Stats which gets checked against a threshold.
+type Metric uint8
+
+// Metric* constants define the observable values. Durations are checked in
+// nanoseconds.
+const (
+	MetricFDs Metric = iota + 1
+	MetricThreads
+	MetricRSS
+	MetricVoluntaryCtxSwitches
+	MetricInvoluntaryCtxSwitches
+	MetricUserTime
+	MetricSystemTime
+	MetricReadBytes
+	MetricWriteBytes
+)
+
+var metricNames = [...]string{
+	MetricFDs:                    "fds",
+	MetricThreads:                "threads",
+	MetricRSS:                    "rss",
+	MetricVoluntaryCtxSwitches:   "voluntary_ctxt_switches",
+	MetricInvoluntaryCtxSwitches: "involuntary_ctxt_switches",
+	MetricUserTime:               "cpu_user",
+	MetricSystemTime:             "cpu_system",
+	MetricReadBytes:              "io_read_bytes",
+	MetricWriteBytes:             "io_write_bytes",
+}
+
+func (m Metric) String() string {
+	if int(m) < len(metricNames) && metricNames[m] != "" {
+		return metricNames[m]
+	}
+	return fmt.Sprintf("Metric(%d)", uint8(m))
+}
+
+func (m Metric) value(s Stats) uint64 {
+	switch m {
+	case MetricFDs:
+		return s.FDs
+	case MetricThreads:
+		return s.Threads
+	case MetricRSS:
+		return s.RSS
+	case MetricVoluntaryCtxSwitches:
+		return s.VoluntaryCtxSwitches
+	case MetricInvoluntaryCtxSwitches:
+		return s.InvoluntaryCtxSwitches
+	case MetricUserTime:
+		return uint64(s.UserTime)
+	case MetricSystemTime:
+		return uint64(s.SystemTime)
+	case MetricReadBytes:
+		return s.ReadBytes
+	case MetricWriteBytes:
+		return s.WriteBytes
+	}
+	return 0
+}
+
+// Options configures Periodically.
+type Options struct {
+	// Root of the proc file system. Defaults to DefaultRoot.
+	Root string
+	// ClockTicks converts the CPU times. Defaults to DefaultClockTicks.
+	ClockTicks int
+	// Interval between two checks. Defaults to one minute.
+	Interval time.Duration
+	// Thresholds defines the checked metrics and their limits. A change
+	// compared to the last logged value which exceeds any threshold logs all
+	// values. Defaults to 10% growth or shrink of the file descriptors,
+	// threads and RSS.
+	Thresholds map[Metric]logmem.Threshold
+	// Message of the log entry. Defaults to "[logproc] process resources".
+	Message string
+	// Fields get added to each log entry.
+	Fields log.Fields
+}
+
+// Periodically logs the process resources each time a metric exceeds its
+// threshold, compared to the last logged values. The resources get read once
+// before starting the goroutine, to return an error if the proc file system
+// does not exist. Read errors in the goroutine get logged. If Info level in
+// the logger has been disabled, no logging will happen. Debug level logs the
+// termination of the goroutine.
+//
+//	p, err := logproc.Periodically(ctx, l, logproc.Options{
+//		Interval: 30 * time.Second,
+//		Thresholds: map[logproc.Metric]logmem.Threshold{
+//			logproc.MetricFDs:      {GrowthPercent: 20},
+//			logproc.MetricUserTime: {GrowthAbs: uint64(10 * time.Second)},
+//		},
+//	})
+func Periodically(ctx context.Context, l log.Logger, o Options) (*logmem.Periodic, error) {
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Thresholds == nil {
+		th := logmem.Threshold{GrowthPercent: 10, ShrinkPercent: 10}
+		o.Thresholds = map[Metric]logmem.Threshold{
+			MetricFDs:     th,
+			MetricThreads: th,
+			MetricRSS:     th,
+		}
+	}
+	if o.Message == "" {
+		o.Message = "[logproc] process resources"
+	}
+	metrics := make([]Metric, 0, len(o.Thresholds))
+	for m := range o.Thresholds {
+		metrics = append(metrics, m)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i] < metrics[j] })
+
+	prev, err := Read(o.Root, o.ClockTicks)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return logmem.NewPeriodic(ctx, func(ctx context.Context) {
+		tick := time.NewTicker(o.Interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if !l.IsInfo() {
+					continue
+				}
+				cur, err := Read(o.Root, o.ClockTicks)
+				if err != nil {
+					l.Info(o.Message, append(log.Fields{log.Err(err)}, o.Fields...)...)
+					continue
+				}
+				var triggered []string
+				for _, m := range metrics {
+					if o.Thresholds[m].Exceeded(m.value(prev), m.value(cur)) {
+						triggered = append(triggered, m.String())
+					}
+				}
+				if len(triggered) == 0 {
+					continue
+				}
+				fields := append(log.Fields{log.Strings("trigger", triggered...)}, statsFields(prev, cur)...)
+				l.Info(o.Message, append(fields, o.Fields...)...)
+				prev = cur
+			case <-ctx.Done():
+				if l.IsDebug() {
+					l.Debug("logproc.Periodically.terminated.done", log.Err(ctx.Err()))
+				}
+				return
+			}
+		}
+	}), nil
+}
+
+func statsFields(prev, cur Stats) log.Fields {
+	return log.Fields{
+		log.Uint64("fds", cur.FDs),
+		log.Uint64("fd_limit", cur.FDLimit),
+		log.Float64("fd_usage_percent", cur.FDPercent()),
+		log.Uint64("threads", cur.Threads),
+		log.Float64("rss_mb", logmem.ToMB(cur.RSS)),
+		log.Uint64("voluntary_ctxt_switches", cur.VoluntaryCtxSwitches),
+		log.Uint64("involuntary_ctxt_switches", cur.InvoluntaryCtxSwitches),
+		log.Float64("cpu_user_seconds", cur.UserTime.Seconds()),
+		log.Float64("cpu_system_seconds", cur.SystemTime.Seconds()),
+		log.Uint64("io_read_bytes", cur.ReadBytes),
+		log.Uint64("io_write_bytes", cur.WriteBytes),
+
+		log.Int64("diff_fds", logmem.Diff(prev.FDs, cur.FDs)),
+		log.Int64("diff_threads", logmem.Diff(prev.Threads, cur.Threads)),
+		log.Float64("diff_rss_mb", logmem.DiffMB(prev.RSS, cur.RSS)),
+		log.Int64("diff_voluntary_ctxt_switches", logmem.Diff(prev.VoluntaryCtxSwitches, cur.VoluntaryCtxSwitches)),
+		log.Int64("diff_involuntary_ctxt_switches", logmem.Diff(prev.InvoluntaryCtxSwitches, cur.InvoluntaryCtxSwitches)),
+		log.Float64("diff_cpu_user_seconds", (cur.UserTime - prev.UserTime).Seconds()),
+		log.Float64("diff_cpu_system_seconds", (cur.SystemTime - prev.SystemTime).Seconds()),
+		log.Int64("diff_io_read_bytes", logmem.Diff(prev.ReadBytes, cur.ReadBytes)),
+		log.Int64("diff_io_write_bytes", logmem.Diff(prev.WriteBytes, cur.WriteBytes)),
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logproc_test
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/corestoreio/log/logproc"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestRead_Proc(t *testing.T) {
+	s, err := logproc.Read("", 0)
+	assert.NoError(t, err)
+	assert.True(t, s.FDs > 0, "FDs: %d", s.FDs)
+	assert.True(t, s.Threads > 0, "Threads: %d", s.Threads)
+	assert.True(t, s.RSS > 0, "RSS: %d", s.RSS)
+
+	// The descriptor which reads the fd directory must not be counted.
+	var open uint64
+	var st syscall.Stat_t
+	for fd := 0; fd < 4096; fd++ {
+		if syscall.Fstat(fd, &st) == nil {
+			open++
+		}
+	}
+	assert.Exactly(t, open, s.FDs)
+}
@@ -0,0 +1,179 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logproc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logmem"
+	"github.com/corestoreio/log/logproc"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+const (
+	fakeLimits = `Limit                     Soft Limit           Hard Limit           Units
+Max cpu time              unlimited            unlimited            seconds
+Max open files            1024                 1048576              files
+Max locked memory         8388608              8388608              bytes
+`
+	fakeStatus = `Name:	my app
+State:	S (sleeping)
+VmRSS:	   20480 kB
+Threads:	%d
+voluntary_ctxt_switches:	150
+nonvoluntary_ctxt_switches:	7
+`
+	fakeStat = `4711 (my app) S 1 4711 4711 0 -1 4194560 1234 0 0 0 250 75 0 0 20 0 12 0 220607 2703360 286`
+	fakeIO   = "rchar: 3980\nwchar: 10\nread_bytes: 4096\nwrite_bytes: 8192\n"
+)
+
+// writeFakeProc creates a proc tree in root with fds open file descriptors
+// and the number of threads.
+func writeFakeProc(t *testing.T, root string, fds, threads int) {
+	t.Helper()
+	dir := filepath.Join(root, "self")
+	fdDir := filepath.Join(dir, "fd")
+	assert.NoError(t, os.MkdirAll(fdDir, 0o755))
+	existing, err := ioutil.ReadDir(fdDir)
+	assert.NoError(t, err)
+	for i := fds; i < len(existing); i++ {
+		assert.NoError(t, os.Remove(filepath.Join(fdDir, strconv.Itoa(i))))
+	}
+	for i := len(existing); i < fds; i++ {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(fdDir, strconv.Itoa(i)), nil, 0o644))
+	}
+	files := map[string]string{
+		"limits": fakeLimits,
+		"status": fmtThreads(fakeStatus, threads),
+		"stat":   fakeStat,
+		"io":     fakeIO,
+	}
+	for name, content := range files {
+		// Rename replaces the file atomically for concurrent readers.
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path+".tmp", []byte(content), 0o644))
+		assert.NoError(t, os.Rename(path+".tmp", path))
+	}
+}
+
+func fmtThreads(format string, threads int) string {
+	return strings.Replace(format, "%d", strconv.Itoa(threads), 1)
+}
+
+func TestRead(t *testing.T) {
+	root := t.TempDir()
+	writeFakeProc(t, root, 3, 12)
+
+	s, err := logproc.Read(root, 0)
+	assert.NoError(t, err)
+	assert.Exactly(t, logproc.Stats{
+		FDs:                    3,
+		FDLimit:                1024,
+		Threads:                12,
+		RSS:                    20480 * 1024,
+		VoluntaryCtxSwitches:   150,
+		InvoluntaryCtxSwitches: 7,
+		UserTime:               2500 * time.Millisecond,
+		SystemTime:             750 * time.Millisecond,
+		ReadBytes:              4096,
+		WriteBytes:             8192,
+	}, s)
+	assert.Exactly(t, 0.29, s.FDPercent())
+
+	s, err = logproc.Read(root, 1000)
+	assert.NoError(t, err)
+	assert.Exactly(t, 250*time.Millisecond, s.UserTime)
+}
+
+func TestRead_OptionalIO(t *testing.T) {
+	root := t.TempDir()
+	writeFakeProc(t, root, 1, 1)
+	assert.NoError(t, os.Remove(filepath.Join(root, "self", "io")))
+
+	s, err := logproc.Read(root, 0)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint64(0), s.ReadBytes)
+	assert.Exactly(t, uint64(1), s.Threads)
+}
+
+func TestRead_Errors(t *testing.T) {
+	_, err := logproc.Read(t.TempDir(), 0)
+	assert.True(t, errors.Cause(err) != nil && os.IsNotExist(errors.Cause(err)), "%+v", err)
+
+	root := t.TempDir()
+	writeFakeProc(t, root, 1, 1)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "self", "stat"), []byte("4711 (app) S 1"), 0o644))
+	_, err = logproc.Read(root, 0)
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
+
+func TestPeriodically(t *testing.T) {
+	root := t.TempDir()
+	writeFakeProc(t, root, 10, 12)
+
+	var buf log.MutexBuffer
+	l := logw.NewLog(logw.WithWriter(&buf), logw.WithLevel(logw.LevelDebug), logw.WithFlag(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	p, err := logproc.Periodically(ctx, l, logproc.Options{
+		Root:     root,
+		Interval: time.Millisecond,
+		Thresholds: map[logproc.Metric]logmem.Threshold{
+			logproc.MetricFDs:     {GrowthAbs: 5},
+			logproc.MetricThreads: {ShrinkPercent: 50},
+		},
+		Fields: log.Fields{log.String("app", "test")},
+	})
+	assert.NoError(t, err)
+
+	writeFakeProc(t, root, 14, 12) // below the threshold
+	writeFakeProc(t, root, 15, 12)
+	assert.NoError(t, buf.WaitFor(ctx, `trigger: "fds"`))
+	writeFakeProc(t, root, 15, 6)
+	assert.NoError(t, buf.WaitFor(ctx, `trigger: "threads"`))
+	p.Stop()
+
+	out := buf.String()
+	assert.Contains(t, out, `INFO [logproc] process resources trigger: "fds" fds: 15 fd_limit: 1024 fd_usage_percent: 1.46 threads: 12 rss_mb: 20 voluntary_ctxt_switches: 150 involuntary_ctxt_switches: 7 cpu_user_seconds: 2.5 cpu_system_seconds: 0.75 io_read_bytes: 4096 io_write_bytes: 8192 diff_fds: 5 diff_threads: 0 diff_rss_mb: 0`)
+	assert.Contains(t, out, `trigger: "threads" fds: 15`)
+	assert.Contains(t, out, `diff_threads: -6`)
+	assert.Contains(t, out, `app: "test"`)
+	assert.Contains(t, out, `DEBUG logproc.Periodically.terminated.done error: "context canceled"`)
+	assert.Exactly(t, 2, buf.Count("INFO"))
+}
+
+func TestPeriodically_NotFound(t *testing.T) {
+	p, err := logproc.Periodically(context.Background(), logw.NewLog(), logproc.Options{Root: t.TempDir()})
+	assert.Nil(t, p)
+	assert.Error(t, err)
+}
+
+func TestMetric_String(t *testing.T) {
+	assert.Exactly(t, "fds", logproc.MetricFDs.String())
+	assert.Exactly(t, "io_write_bytes", logproc.MetricWriteBytes.String())
+	assert.Exactly(t, "Metric(99)", logproc.Metric(99).String())
+}
@@ -0,0 +1,47 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"testing"
+
+	"github.com/corestoreio/log"
+)
+
+// BenchmarkWith measures an Info call of a request scoped logger, which has
+// been created by With with eight context fields. l must have Info level
+// enabled and should write to a discarding writer, so the numbers of the
+// log.Logger implementations can be compared.
+//
+//	func BenchmarkLog_With(b *testing.B) {
+//		logtest.BenchmarkWith(b, logw.NewLog(logw.WithWriter(ioutil.Discard)))
+//	}
+func BenchmarkWith(b *testing.B, l log.Logger) {
+	l = l.With(
+		log.String("request_id", "01E4QAF0TD9JHHGS8Q3X7K6E2N"),
+		log.String("method", "GET"),
+		log.String("path", "/catalog/product/4711"),
+		log.String("remote_addr", "192.0.2.1"),
+		log.Int("store_id", 1),
+		log.Int64("customer_id", 815),
+		log.Bool("logged_in", true),
+		log.Float64("ab_ratio", 0.5),
+	)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("Product viewed", log.Int("status", 200))
+	}
+}
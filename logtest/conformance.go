@@ -0,0 +1,541 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/log"
+)
+
+// Factory creates the logger under test with the minimum level lvl. The
+// returned function decodes all entries written so far, for example with
+// DecodeJSON or DecodeText. The logger must be safe for concurrent use.
+type Factory func(t testing.TB, lvl Level) (l log.Logger, entries func() Entries)
+
+// Conformance runs a test suite against a log.Logger implementation. It
+// covers all field constructors, Nest and Marshal, With chaining and
+// immutability, the eager evaluation of With fields, level guards, the
+// propagation of StringFn and Marshaler errors and concurrent use. Run it
+// with -race.
+//
+// Values get compared by their kind: numbers must be encoded as numbers,
+// strings as strings and booleans as booleans. Nested fields can either be
+// flattened or prefixed with the namespace, separated by a dot.
+func Conformance(t *testing.T, newLogger Factory) {
+	t.Run("Fields", func(t *testing.T) { conformFields(t, newLogger) })
+	t.Run("Nest_Marshal", func(t *testing.T) { conformNest(t, newLogger) })
+	t.Run("With", func(t *testing.T) { conformWith(t, newLogger) })
+	t.Run("With_Evaluation", func(t *testing.T) { conformWithEvaluation(t, newLogger) })
+	t.Run("Levels", func(t *testing.T) { conformLevels(t, newLogger) })
+	t.Run("Errors", func(t *testing.T) { conformErrors(t, newLogger) })
+	t.Run("Concurrent", func(t *testing.T) { conformConcurrent(t, newLogger) })
+}
+
+type goStringer struct{}
+
+func (goStringer) GoString() string { return "logtest.goStringer{}" }
+
+type conformMarshaler struct {
+	err error
+}
+
+func (cm conformMarshaler) MarshalLog(kv log.KeyValuer) error {
+	kv.AddString("m_string", "s1")
+	kv.AddUint64("m_uint64", math.MaxUint32+1)
+	if err := kv.Nest("m_nest", func(kv log.KeyValuer) error {
+		kv.AddInt64("m_nested", 4711)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return cm.err
+}
+
+func conformFields(t *testing.T, newLogger Factory) {
+	tests := []struct {
+		field log.Field
+		want  interface{}
+	}{
+		{log.Bool("bool", true), true},
+		{log.Float64("float64", 3.25), 3.25},
+		{log.Int("int", -42), -42},
+		{log.Ints("ints", 1, 2, 3), "1, 2, 3"},
+		{log.Int64("int64", -1<<40), int64(-1 << 40)},
+		{log.Int64s("int64s", 4, 5), "4, 5"},
+		{log.Uint("uint", 7), uint64(7)},
+		{log.Uint64("uint64", math.MaxUint64), uint64(math.MaxUint64)},
+		{log.String("string", `with "quotes"`), `with "quotes"`},
+		{log.Strings("strings", "a", "b"), "a, b"},
+		{log.StringFn("stringfn", func(add log.AddStringFn) error { add("stringfn", "fn"); return nil }), "fn"},
+		{log.Stringer("stringer", 90*time.Second), "1m30s"},
+		{log.GoStringer("gostringer", goStringer{}), "logtest.goStringer{}"},
+		{log.Text("text", net.IPv4(127, 0, 0, 1)), "127.0.0.1"},
+		{log.JSON("json", json.RawMessage(`{"a":1}`)), `{"a":1}`},
+		{log.Time("time", time.Unix(0, 1500)), int64(1500)},
+		{log.Duration("duration", 2*time.Second), int64(2e9)},
+		{log.UnixNanoHuman("unixnanohuman", 100*int64(time.Second)), time.Unix(100, 0).String()},
+		{log.Err(errors.New("boom")), "boom"},
+		{log.ErrWithKey("errwithkey", errors.New("bang")), "bang"},
+		{log.Object("object", 42), 42},
+		{log.ObjectTypeOf("objecttypeof", 42), "int"},
+	}
+	l, entries := newLogger(t, LevelDebug)
+	for i, test := range tests {
+		l.Info("field_"+strconv.Itoa(i), test.field)
+	}
+	es := entries()
+	if len(es) != len(tests) {
+		t.Fatalf("Want %d entries, have %d: %#v", len(tests), len(es), es)
+	}
+	for i, test := range tests {
+		key := fieldKey(test.field)
+		assertValue(t, es[i], key, test.want)
+	}
+}
+
+// fieldKey returns the key of a field by encoding it.
+func fieldKey(f log.Field) string {
+	fs := collectFields(log.Fields{f})
+	if len(fs) == 0 {
+		return ""
+	}
+	return fs[0].Key
+}
+
+func conformNest(t *testing.T, newLogger Factory) {
+	l, entries := newLogger(t, LevelDebug)
+	l.Info("nest", log.Nest("ns", log.Int("n_int", 1), log.String("n_string", "two")))
+	l.Info("marshal", log.Marshal("m", conformMarshaler{}))
+	l.Info("fields", log.Fields{log.Int("f1", 1), log.Int("f2", 2)})
+
+	es := entries()
+	if len(es) != 3 {
+		t.Fatalf("Want 3 entries, have %d: %#v", len(es), es)
+	}
+	assertValue(t, es[0], "n_int", 1)
+	assertValue(t, es[0], "n_string", "two")
+	assertValue(t, es[1], "m_string", "s1")
+	assertValue(t, es[1], "m_uint64", uint64(math.MaxUint32+1))
+	assertValue(t, es[1], "m_nested", int64(4711))
+	assertValue(t, es[2], "f1", 1)
+	assertValue(t, es[2], "f2", 2)
+}
+
+func conformWith(t *testing.T, newLogger Factory) {
+	l, entries := newLogger(t, LevelDebug)
+	// Three fields in one call give the context slice a capacity of three,
+	// the next With grows it with spare capacity which two grandchildren
+	// must not share.
+	parent := l.With(log.String("p1", "1"), log.String("p2", "2"), log.String("p3", "3"))
+	child := parent.With(log.String("c", "1"))
+	g1 := child.With(log.String("g", "1"))
+	g2 := child.With(log.String("g", "2"))
+
+	g1.Info("g1", log.Int("i", 1))
+	g2.Info("g2", log.Int("i", 2))
+	child.Info("child")
+	parent.Info("parent")
+	l.Info("root")
+
+	es := entries()
+	if len(es) != 5 {
+		t.Fatalf("Want 5 entries, have %d: %#v", len(es), es)
+	}
+	assertValue(t, es[0], "p1", "1")
+	assertValue(t, es[0], "p2", "2")
+	assertValue(t, es[0], "p3", "3")
+	assertValue(t, es[0], "c", "1")
+	assertValue(t, es[0], "g", "1")
+	assertValue(t, es[0], "i", 1)
+	assertValue(t, es[1], "g", "2")
+	assertValue(t, es[1], "i", 2)
+	assertValue(t, es[2], "c", "1")
+	assertMissing(t, es[2], "g")
+	assertValue(t, es[3], "p3", "3")
+	assertMissing(t, es[3], "c")
+	assertMissing(t, es[4], "p1")
+}
+
+// countMarshaler counts its evaluations.
+type countMarshaler struct {
+	n *int
+}
+
+func (cm countMarshaler) MarshalLog(kv log.KeyValuer) error {
+	*cm.n++
+	kv.AddInt("ctx_m", *cm.n)
+	return nil
+}
+
+// conformWithEvaluation checks the semantics of log.Logger.With: context
+// fields get evaluated once when With gets called and an error of a context
+// field gets logged before the fields of the log call.
+func conformWithEvaluation(t *testing.T, newLogger Factory) {
+	l, entries := newLogger(t, LevelDebug)
+	var fnCalls, mCalls int
+	ctx := l.With(
+		log.StringFn("ctx_fn", func(add log.AddStringFn) error {
+			fnCalls++
+			add("ctx_fn", strconv.Itoa(fnCalls))
+			return nil
+		}),
+		log.Marshal("ctx_m", countMarshaler{n: &mCalls}),
+	)
+	if fnCalls != 1 || mCalls != 1 {
+		t.Errorf("With must evaluate the context fields once when called, have %d StringFn and %d Marshaler calls", fnCalls, mCalls)
+	}
+	ctx.Info("first", log.Int("i", 1))
+	ctx.Debug("second", log.Int("i", 2))
+	if fnCalls != 1 || mCalls != 1 {
+		t.Errorf("Log calls must not evaluate the context fields again, have %d StringFn and %d Marshaler calls", fnCalls, mCalls)
+	}
+
+	// The key of the call field sorts after "error", so decoders which sort
+	// the keys keep the order.
+	errCtx := l.With(log.StringFn("ctx_err", func(log.AddStringFn) error {
+		return errors.New("context failed")
+	}))
+	errCtx.Info("context_error", log.String("x_call", "x"))
+	l.Info("root")
+
+	es := entries()
+	if len(es) != 4 {
+		t.Fatalf("Want 4 entries, have %d: %#v", len(es), es)
+	}
+	for _, e := range es[:2] {
+		assertValue(t, e, "ctx_fn", "1")
+		assertValue(t, e, "ctx_m", 1)
+	}
+	assertValue(t, es[2], "x_call", "x")
+	errPos, callPos := -1, -1
+	for i, f := range es[2].AllFields() {
+		switch {
+		case matchKey(f.Key, log.KeyNameError) && strings.Contains(fmt.Sprint(f.Value), "context failed"):
+			errPos = i
+		case matchKey(f.Key, "x_call"):
+			callPos = i
+		}
+	}
+	if errPos < 0 || errPos > callPos {
+		t.Errorf("Entry %q: want field %q containing %q before the call fields, have %s", es[2].Message, log.KeyNameError, "context failed", es[2])
+	}
+	assertMissing(t, es[3], log.KeyNameError)
+}
+
+func conformLevels(t *testing.T, newLogger Factory) {
+	l, entries := newLogger(t, LevelInfo)
+	if l.IsDebug() {
+		t.Error("IsDebug must return false for LevelInfo")
+	}
+	if !l.IsInfo() {
+		t.Error("IsInfo must return true for LevelInfo")
+	}
+	l.Debug("hidden")
+	l.With(log.Int("n", 1)).Debug("hidden")
+	l.Info("shown")
+	es := entries()
+	if len(es) != 1 || es[0].Message != "shown" || es[0].Level != LevelInfo {
+		t.Errorf("Want only the Info entry, have %#v", es)
+	}
+
+	l, entries = newLogger(t, LevelDebug)
+	if !l.IsDebug() || !l.IsInfo() {
+		t.Error("IsDebug and IsInfo must return true for LevelDebug")
+	}
+	l.Debug("debug")
+	l.Info("info")
+	es = entries()
+	if len(es) != 2 || es[0].Level != LevelDebug || es[1].Level != LevelInfo {
+		t.Errorf("Want a Debug and an Info entry, have %#v", es)
+	}
+}
+
+func conformErrors(t *testing.T, newLogger Factory) {
+	l, entries := newLogger(t, LevelDebug)
+	l.Info("stringfn", log.StringFn("fn", func(log.AddStringFn) error {
+		return errors.New("stringfn failed")
+	}))
+	l.Info("marshaler", log.Marshal("m", conformMarshaler{err: errors.New("marshaler failed")}))
+
+	es := entries()
+	if len(es) != 2 {
+		t.Fatalf("Want 2 entries, have %d: %#v", len(es), es)
+	}
+	for i, want := range []string{"stringfn failed", "marshaler failed"} {
+		v, ok := lookupField(es[i], log.KeyNameError)
+		if s, isStr := v.(string); !ok || !isStr || !strings.Contains(s, want) {
+			t.Errorf("Entry %q: want field %q containing %q, have %#v", es[i].Message, log.KeyNameError, want, v)
+		}
+	}
+	assertValue(t, es[1], "m_string", "s1")
+}
+
+func conformConcurrent(t *testing.T, newLogger Factory) {
+	const goroutines, iterations = 8, 50
+	l, entries := newLogger(t, LevelDebug)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			gl := l.With(log.Int("g", g))
+			for i := 0; i < iterations; i++ {
+				gl.With(log.Int("i", i)).Debug("concurrent", log.String("k", "v"))
+				_ = gl.IsDebug()
+			}
+		}(g)
+	}
+	wg.Wait()
+	if es := entries(); len(es) != goroutines*iterations {
+		t.Errorf("Want %d entries, have %d", goroutines*iterations, len(es))
+	}
+}
+
+// lookupField returns the value of the key. If the key cannot be found, a key
+// with the suffix "."+key gets searched, which covers namespaced fields.
+func lookupField(e Entry, key string) (interface{}, bool) {
+	if v, ok := e.Field(key); ok {
+		return v, true
+	}
+	for _, f := range e.AllFields() {
+		if strings.HasSuffix(f.Key, "."+key) {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// matchKey reports whether k equals key or ends with the namespaced key.
+func matchKey(k, key string) bool {
+	return k == key || strings.HasSuffix(k, "."+key)
+}
+
+func assertMissing(t *testing.T, e Entry, key string) {
+	t.Helper()
+	if v, ok := lookupField(e, key); ok {
+		t.Errorf("Entry %q: field %q must not exist, have %#v", e.Message, key, v)
+	}
+}
+
+func assertValue(t *testing.T, e Entry, key string, want interface{}) {
+	t.Helper()
+	got, ok := lookupField(e, key)
+	if !ok {
+		t.Errorf("Entry %q: field %q not found in %s", e.Message, key, e)
+		return
+	}
+	if !conformEqual(got, want) {
+		t.Errorf("Entry %q: field %q\nhave %#v (%T)\nwant %#v (%T)", e.Message, key, got, got, want, want)
+	}
+}
+
+// conformEqual compares by kind: numbers must be numbers, strings strings and
+// booleans booleans.
+func conformEqual(got, want interface{}) bool {
+	switch w := want.(type) {
+	case bool, string:
+		return got == want
+	case float64:
+		switch g := got.(type) {
+		case json.Number:
+			f, err := g.Float64()
+			return err == nil && f == w
+		case float64:
+			return g == w
+		}
+		return false
+	}
+	if n, ok := got.(json.Number); ok {
+		return n.String() == fmt.Sprint(want)
+	}
+	if _, _, ok := toInteger(got); !ok {
+		return false
+	}
+	return equalValue(got, want)
+}
+
+// DecodeJSON decodes JSON lines, one object per entry. The message and the
+// level get read from the keys msgKey and levelKey. Levels starting with "d"
+// or "D" become LevelDebug, with "i" or "I" LevelInfo. All other keys become
+// fields with numbers as json.Number. Nested objects get flattened and their
+// keys joined with a dot.
+func DecodeJSON(t testing.TB, data []byte, msgKey, levelKey string) Entries {
+	t.Helper()
+	var es Entries
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("[logtest] DecodeJSON: %s in line %q", err, line)
+		}
+		e := Entry{Level: parseLevel(fmt.Sprint(m[levelKey]))}
+		e.Message, _ = m[msgKey].(string)
+		delete(m, msgKey)
+		delete(m, levelKey)
+		e.Fields = flattenJSON("", m)
+		es = append(es, e)
+	}
+	return es
+}
+
+func flattenJSON(prefix string, m map[string]interface{}) []Field {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var fs []Field
+	for _, k := range keys {
+		if nested, ok := m[k].(map[string]interface{}); ok {
+			fs = append(fs, flattenJSON(prefix+k+".", nested)...)
+			continue
+		}
+		fs = append(fs, Field{Key: prefix + k, Value: m[k]})
+	}
+	return fs
+}
+
+func parseLevel(s string) Level {
+	switch {
+	case strings.HasPrefix(s, "d"), strings.HasPrefix(s, "D"):
+		return LevelDebug
+	case strings.HasPrefix(s, "i"), strings.HasPrefix(s, "I"):
+		return LevelInfo
+	}
+	return 0
+}
+
+// DecodeText decodes lines in the format of log.Fields.ToString, as written by
+// logw and log.WriteTypes. Each entry starts with one of the prefixes, lines
+// without a prefix continue the previous entry, for example multi line error
+// stack traces. Quoted values become strings, true and false booleans,
+// numbers json.Number and everything else an unquoted string. Keys must not
+// contain white space and messages must not contain ": ".
+func DecodeText(t testing.TB, data []byte, prefixes map[string]Level) Entries {
+	t.Helper()
+	var lines []string
+	var levels []Level
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		lvl, rest, ok := cutPrefix(line, prefixes)
+		if !ok {
+			if len(lines) == 0 {
+				t.Fatalf("[logtest] DecodeText: line %q has no known prefix", line)
+			}
+			lines[len(lines)-1] += "\n" + line
+			continue
+		}
+		lines = append(lines, rest)
+		levels = append(levels, lvl)
+	}
+
+	es := make(Entries, 0, len(lines))
+	for i, line := range lines {
+		e := Entry{Level: levels[i]}
+		pos := nextTextKey(line, 0)
+		if pos < 0 {
+			e.Message = line
+			es = append(es, e)
+			continue
+		}
+		e.Message = line[:pos]
+		for pos >= 0 && pos < len(line) {
+			sep := strings.Index(line[pos+1:], log.AssignmentChar)
+			key := line[pos+1 : pos+1+sep]
+			vStart := pos + 1 + sep + len(log.AssignmentChar)
+			var value interface{}
+			if strings.HasPrefix(line[vStart:], `"`) {
+				q, err := strconv.QuotedPrefix(line[vStart:])
+				if err != nil {
+					t.Fatalf("[logtest] DecodeText: %s in line %q", err, line)
+				}
+				value, _ = strconv.Unquote(q)
+				pos = vStart + len(q)
+			} else {
+				next := nextTextKey(line, vStart)
+				end := next
+				if end < 0 {
+					end = len(line)
+				}
+				value = parseTextValue(line[vStart:end])
+				pos = next
+			}
+			e.Fields = append(e.Fields, Field{Key: key, Value: value})
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+func cutPrefix(line string, prefixes map[string]Level) (Level, string, bool) {
+	for p, lvl := range prefixes {
+		if strings.HasPrefix(line, p) {
+			return lvl, line[len(p):], true
+		}
+	}
+	return 0, "", false
+}
+
+// nextTextKey returns the position of the separator in front of the next
+// "key: " starting at from, or -1.
+func nextTextKey(line string, from int) int {
+	for i := from; i < len(line); i++ {
+		if !strings.HasPrefix(line[i:], log.Separator) {
+			continue
+		}
+		j := i + len(log.Separator)
+		k := j
+		for k < len(line) && line[k] != ' ' && line[k] != '\n' && line[k] != '\t' && line[k] != '"' {
+			if strings.HasPrefix(line[k:], log.AssignmentChar) {
+				break
+			}
+			k++
+		}
+		if k > j && strings.HasPrefix(line[k:], log.AssignmentChar) {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseTextValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(s)
+	}
+	if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return json.Number(s)
+	}
+	return s
+}
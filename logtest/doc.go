@@ -13,5 +13,9 @@
 // limitations under the License.
 
 // Package logtest provides a testing.TB compatible logger for debugging
-// purposes.
+// purposes, an Observer which records structured entries for assertions, the
+// Conformance test suite for log.Logger implementations and golden file
+// helpers to lock down the output format. Run go test -update, or
+// LOGTEST_UPDATE=1 go test, to regenerate the golden files in the testdata
+// directory.
 package logtest
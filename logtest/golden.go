@@ -0,0 +1,181 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/log"
+)
+
+// UpdateFlag defines the name of the command line flag which regenerates the
+// golden files: go test ./... -update
+// The flag gets registered by this package unless it has already been
+// defined. A test package which defines its own -update flag must therefore
+// use flag.Lookup instead of flag.Bool, its value gets respected.
+const UpdateFlag = "update"
+
+// UpdateEnv defines the name of the environment variable which regenerates
+// the golden files, as a fallback for the flag: LOGTEST_UPDATE=1 go test ./...
+const UpdateEnv = "LOGTEST_UPDATE"
+
+func init() {
+	if flag.Lookup(UpdateFlag) == nil {
+		flag.Bool(UpdateFlag, false, "regenerate the golden files of logtest")
+	}
+}
+
+func updateGolden() bool {
+	if f := flag.Lookup(UpdateFlag); f != nil {
+		if ok, _ := strconv.ParseBool(f.Value.String()); ok {
+			return true
+		}
+	}
+	ok, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return ok
+}
+
+// Scrubber normalises variable parts of the log output before it gets
+// compared against a golden file.
+type Scrubber func([]byte) []byte
+
+// ScrubRegexp returns a Scrubber which replaces all matches of the regular
+// expression with repl. repl can contain $1 references as in
+// regexp.ReplaceAll.
+func ScrubRegexp(expr, repl string) Scrubber {
+	re := regexp.MustCompile(expr)
+	return func(b []byte) []byte {
+		return re.ReplaceAll(b, []byte(repl))
+	}
+}
+
+// ScrubField returns a Scrubber which replaces the value of a field with the
+// key, written by log.WriteTypes as `key: value` or as JSON `"key":value`.
+// Useful for durations and timestamps logged as integers.
+func ScrubField(key string) Scrubber {
+	k := regexp.QuoteMeta(key)
+	return ScrubRegexp(`(\b`+k+`: |"`+k+`":)("(?:[^"\\]|\\.)*"|[^\s,}]+)`, `$1<`+strings.ToUpper(key)+`>`)
+}
+
+// Default scrubbers for typical variable output.
+var (
+	// ScrubTimestamps replaces RFC 3339 timestamps and the date and time of the
+	// standard library logger.
+	ScrubTimestamps = ScrubRegexp(`\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`, `<TIME>`)
+	// ScrubDurations replaces durations formatted by time.Duration.String.
+	ScrubDurations = ScrubRegexp(`\b(?:\d+(?:\.\d+)?(?:ns|µs|us|ms|s|m|h))+\b`, `<DURATION>`)
+	// ScrubPointers replaces hexadecimal addresses.
+	ScrubPointers = ScrubRegexp(`0x[0-9a-fA-F]+`, `0x<PTR>`)
+	// ScrubCallers removes the directory and the line number of Go source
+	// files.
+	ScrubCallers = ScrubRegexp(`/?(?:[\w.@-]+/)*([\w.-]+\.go):\d+`, `$1:<LINE>`)
+)
+
+// DefaultScrubbers get applied if no scrubbers have been passed.
+var DefaultScrubbers = []Scrubber{ScrubTimestamps, ScrubDurations, ScrubPointers, ScrubCallers}
+
+// Golden captures the output of a logger and compares it against the golden
+// file testdata/<name>.golden. Golden is safe for concurrent writes.
+//
+//	g := logtest.NewGolden(t, "logw_fields")
+//	l := logw.NewLog(logw.WithWriter(g))
+//	l.Info("msg", log.Int("n", 1))
+//	g.Assert()
+type Golden struct {
+	log.MutexBuffer
+	t         testing.TB
+	name      string
+	scrubbers []Scrubber
+}
+
+// NewGolden creates a new Golden. If no scrubbers have been passed,
+// DefaultScrubbers get applied.
+func NewGolden(t testing.TB, name string, scrubbers ...Scrubber) *Golden {
+	return &Golden{
+		t:         t,
+		name:      name,
+		scrubbers: scrubbers,
+	}
+}
+
+// Assert compares the captured output against the golden file. With the
+// environment variable LOGTEST_UPDATE=1 the golden file gets written instead.
+func (g *Golden) Assert() bool {
+	g.t.Helper()
+	return AssertGolden(g.t, g.name, g.Bytes(), g.scrubbers...)
+}
+
+// AssertGolden scrubs got and compares it against the golden file
+// testdata/<name>.golden. With the environment variable LOGTEST_UPDATE=1 the
+// golden file gets written instead. If no scrubbers have been passed, DefaultScrubbers get applied.
+func AssertGolden(t testing.TB, name string, got []byte, scrubbers ...Scrubber) bool {
+	t.Helper()
+	if len(scrubbers) == 0 {
+		scrubbers = DefaultScrubbers
+	}
+	got = append([]byte(nil), got...)
+	for _, s := range scrubbers {
+		got = s(got)
+	}
+
+	file := filepath.Join("testdata", name+".golden")
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("[logtest] AssertGolden: %s", err)
+		}
+		if err := ioutil.WriteFile(file, got, 0o644); err != nil {
+			t.Fatalf("[logtest] AssertGolden: %s", err)
+		}
+		return true
+	}
+
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Errorf("[logtest] AssertGolden: %s\nRun go test -%s to create it.", err, UpdateFlag)
+		return false
+	}
+	if bytes.Equal(want, got) {
+		return true
+	}
+	t.Errorf("[logtest] Output differs from %s, run go test -%s to update it.\n%s", file, UpdateFlag, lineDiff(want, got))
+	return false
+}
+
+// lineDiff describes the first differing line.
+func lineDiff(want, got []byte) string {
+	wl := strings.Split(string(want), "\n")
+	gl := strings.Split(string(got), "\n")
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if i >= len(wl) || i >= len(gl) || w != g {
+			return "First difference in line " + strconv.Itoa(i+1) + ":\nwant: " + strconv.Quote(w) + "\nhave: " + strconv.Quote(g)
+		}
+	}
+	return ""
+}
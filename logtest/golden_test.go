@@ -0,0 +1,149 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+// goldenTB records the errors instead of failing the test.
+type goldenTB struct {
+	testing.TB
+	errs []string
+}
+
+func (g *goldenTB) Helper() {}
+
+func (g *goldenTB) Errorf(format string, args ...interface{}) {
+	g.errs = append(g.errs, fmt.Sprintf(format, args...))
+}
+
+// goldenLog writes the entries into the Golden.
+type goldenLog struct {
+	*Golden
+}
+
+func (gl goldenLog) Log(args ...interface{}) {
+	fmt.Fprint(gl, args...)
+}
+
+func TestScrubbers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		scrubber Scrubber
+		in, want string
+	}{
+		{ScrubTimestamps, "at 2009/11/10 23:00:00 INFO", "at <TIME> INFO"},
+		{ScrubTimestamps, `"time":"2017-01-02T15:04:05.999999999+01:00"`, `"time":"<TIME>"`},
+		{ScrubTimestamps, "t: 2017-01-02T15:04:05Z x", "t: <TIME> x"},
+		{ScrubDurations, "took: 1m30.5s and 120µs", "took: <DURATION> and <DURATION>"},
+		{ScrubDurations, "version2s", "version2s"},
+		{ScrubPointers, "p: 0xc000012345", "p: 0x<PTR>"},
+		{ScrubCallers, "/home/go/src/github.com/corestoreio/log/log.go:123: x", "log.go:<LINE>: x"},
+		{ScrubCallers, "golden_test.go:42", "golden_test.go:<LINE>"},
+		{ScrubField("rt"), `rt: 12345 x: 1`, `rt: <RT> x: 1`},
+		{ScrubField("rt"), `{"rt":"12 ms","x":1}`, `{"rt":<RT>,"x":1}`},
+		{ScrubField("rt"), `start: 12345`, `start: 12345`},
+	}
+	for _, test := range tests {
+		assert.Exactly(t, test.want, string(test.scrubber([]byte(test.in))), "Input: %q", test.in)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	fs := log.Fields{
+		log.String("str", "Hello \"World\""),
+		log.Int("int", -42),
+		log.Uint64("uint64", 1<<63),
+		log.Float64("float", 3.14159),
+		log.Bool("bool", true),
+		log.String("time", now.Format(time.RFC3339Nano)),
+		log.Stringer("duration", 90*time.Second),
+		log.Err(errors.New("oops")),
+		log.Nest("nest", log.Int("a", 1), log.String("b", "c")),
+		log.Object("ptr", fmt.Sprintf("%p", &now)),
+		log.String("caller", "/tmp/x/handler.go:99"),
+	}
+	AssertGolden(t, "fields_tostring", []byte(fs.ToString("Golden message")))
+}
+
+func TestAssertGolden_Mismatch(t *testing.T) {
+	t.Parallel()
+
+	if updateGolden() {
+		t.Skip("Golden files are being updated")
+	}
+
+	tb := &goldenTB{TB: t}
+	assert.False(t, AssertGolden(tb, "fields_tostring", []byte("Golden message\nother\n")))
+	assert.Len(t, tb.errs, 1)
+	assert.Contains(t, tb.errs[0], "Output differs from testdata/fields_tostring.golden")
+	assert.Contains(t, tb.errs[0], "First difference in line 1")
+
+	tb = &goldenTB{TB: t}
+	assert.False(t, AssertGolden(tb, "not_existing", []byte("x")))
+	assert.Len(t, tb.errs, 1)
+	assert.Contains(t, tb.errs[0], "go test -update")
+}
+
+func TestAssertGolden_UpdateFlag(t *testing.T) {
+	f := flag.Lookup(UpdateFlag)
+	assert.NotNil(t, f)
+	assert.NoError(t, flag.Set(UpdateFlag, "true"))
+	defer func() { assert.NoError(t, flag.Set(UpdateFlag, f.DefValue)) }()
+
+	file := filepath.Join("testdata", "update_flag.golden")
+	defer os.Remove(file)
+
+	assert.True(t, AssertGolden(t, "update_flag", []byte("at 2020-01-02T03:04:05Z\n")))
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Exactly(t, "at <TIME>\n", string(data))
+}
+
+func TestAssertGolden_UpdateEnv(t *testing.T) {
+	t.Setenv(UpdateEnv, "1")
+	file := filepath.Join("testdata", "update_env.golden")
+	defer os.Remove(file)
+
+	assert.True(t, AssertGolden(t, "update_env", []byte("at 2020-01-02T03:04:05Z\n")))
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Exactly(t, "at <TIME>\n", string(data))
+}
+
+func TestGolden_Logger(t *testing.T) {
+	t.Parallel()
+
+	g := NewGolden(t, "golden_logger", ScrubField("id"))
+	l := New(goldenLog{g}, log.Int("id", 4711))
+	l.Info("custom scrubber", log.String("x", "y"))
+	l.Debug("custom scrubber", log.Duration("d", time.Second))
+	assert.True(t, g.Assert())
+}
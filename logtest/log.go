@@ -15,6 +15,9 @@
 package logtest
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/corestoreio/log"
 )
 
@@ -22,59 +25,197 @@ type logger interface {
 	Log(args ...interface{})
 }
 
+// Optional interfaces of the logger, all implemented by testing.TB.
+type (
+	helper interface {
+		Helper()
+	}
+	errorfer interface {
+		Errorf(format string, args ...interface{})
+	}
+	cleanuper interface {
+		Cleanup(func())
+		Failed() bool
+	}
+)
+
+// Option can be used as an argument in NewWithOptions to configure the
+// logger.
+type Option func(*tLog)
+
+// WithFields adds fields to the context of the logger.
+func WithFields(fields ...log.Field) Option {
+	return func(l *tLog) {
+		l.addCtx(fields)
+	}
+}
+
+// WithLevel sets the minimum level which gets logged. Defaults to LevelDebug.
+func WithLevel(lvl Level) Option {
+	return func(l *tLog) {
+		l.s.level = lvl
+	}
+}
+
+// WithFailOnError fails the test with Errorf if an entry contains a non-nil
+// error field, see log.Err, unless its message contains one of the expected
+// snippets. The logger must implement Errorf like testing.TB.
+func WithFailOnError(expected ...string) Option {
+	return func(l *tLog) {
+		l.s.failOnError = true
+		l.s.expectedErrors = expected
+	}
+}
+
+// WithHelper marks the logging functions as test helpers, so the output
+// points to the caller of Debug or Info. The logger must implement Helper
+// like testing.TB.
+func WithHelper() Option {
+	return func(l *tLog) {
+		l.s.helper = true
+	}
+}
+
+// WithPrintOnFailure captures all entries and prints them only if the test
+// has failed, to keep the output of go test -v readable. The logger must
+// implement Cleanup and Failed like testing.TB, otherwise the entries get
+// printed immediately.
+func WithPrintOnFailure() Option {
+	return func(l *tLog) {
+		l.s.onFailure = true
+	}
+}
+
 // New creates a logger based on the "testing.TB.Log" function and logs
-// level independent, for now. Signature of `logger`:
+// level independent. Signature of `logger`:
 //		type logger interface {
 //			Log(args ...interface{})
 //		}
 func New(l logger, fields ...log.Field) log.Logger {
-	return &tLog{
-		l:   l,
-		ctx: fields,
+	return NewWithOptions(l, WithFields(fields...))
+}
+
+// NewWithOptions creates a logger based on the "testing.TB.Log" function
+// which can be configured with options. Some options require that l
+// implements more functions of testing.TB.
+func NewWithOptions(l logger, opts ...Option) log.Logger {
+	tl := &tLog{
+		l: l,
+		s: &tLogState{level: LevelDebug},
+	}
+	for _, o := range opts {
+		o(tl)
+	}
+	if c, ok := l.(cleanuper); ok && tl.s.onFailure {
+		tl.s.captured = []string{}
+		c.Cleanup(func() {
+			if !c.Failed() {
+				return
+			}
+			tl.s.mu.Lock()
+			defer tl.s.mu.Unlock()
+			for _, line := range tl.s.captured {
+				l.Log(line)
+			}
+			tl.s.captured = nil
+		})
 	}
+	return tl
+}
+
+type tLogState struct {
+	level          Level
+	failOnError    bool
+	expectedErrors []string
+	helper         bool
+	onFailure      bool
+	mu             sync.Mutex
+	captured       []string // nil if entries get printed immediately
 }
 
 type tLog struct {
 	l logger
-	// ctx is only set when we act as a child logger
-	ctx log.Fields
+	s *tLogState
+	// ctx contains the encoded fields of With, see log.Fields.Encode.
+	ctx string
+	// ctxErr reports whether ctx contains a non-nil error field.
+	ctxErr bool
 }
 
 // With returns a new Logger that has this logger's context plus the given
-// Fields.
+// Fields. The fields get evaluated immediately, see log.Logger.With.
 func (l *tLog) With(fields ...log.Field) log.Logger {
 	l2 := new(tLog)
 	*l2 = *l
-	l2.ctx = append(l2.ctx, fields...)
+	l2.addCtx(fields)
 	return l2
 }
 
-func (l *tLog) prependCtx(fields log.Fields) log.Fields {
-	if ctxl := len(l.ctx); ctxl > 0 {
-		all := make(log.Fields, 0, ctxl+len(fields))
-		all = append(all, l.ctx...)
-		all = append(all, fields...)
-		fields = all
-	}
-	return fields
+func (l *tLog) addCtx(fields log.Fields) {
+	captured, hasErr := log.Capture(fields...)
+	l.ctx += captured.Encode()
+	l.ctxErr = l.ctxErr || hasErr
 }
 
 // Debug outputs information for developers including a stack trace.
 func (l *tLog) Debug(msg string, fields ...log.Field) {
-	l.l.Log("[DEBUG] ", l.prependCtx(fields).ToString(msg))
+	if h, ok := l.l.(helper); ok && l.s.helper {
+		h.Helper()
+	}
+	l.log(LevelDebug, "[DEBUG] ", msg, fields)
 }
 
 // Info outputs information for users of the app
 func (l *tLog) Info(msg string, fields ...log.Field) {
-	l.l.Log("[INFO] ", l.prependCtx(fields).ToString(msg))
+	if h, ok := l.l.(helper); ok && l.s.helper {
+		h.Helper()
+	}
+	l.log(LevelInfo, "[INFO] ", msg, fields)
+}
+
+func (l *tLog) log(lvl Level, prefix, msg string, fields log.Fields) {
+	// Helper marks only the calling function, hence Debug and Info call it too.
+	if h, ok := l.l.(helper); ok && l.s.helper {
+		h.Helper()
+	}
+	if lvl < l.s.level {
+		return
+	}
+	// The fields get evaluated only once, for the line and the error check.
+	captured, hasErr := log.Capture(fields...)
+	line := captured.ToStringEncoded(msg, l.ctx)
+	if e, ok := l.l.(errorfer); ok && l.s.failOnError && l.unexpectedError(msg, hasErr) {
+		e.Errorf("[logtest] Unexpected error logged: %s%s", prefix, line)
+	}
+
+	l.s.mu.Lock()
+	if l.s.captured != nil {
+		l.s.captured = append(l.s.captured, prefix+line)
+		l.s.mu.Unlock()
+		return
+	}
+	l.s.mu.Unlock()
+	l.l.Log(prefix, line)
+}
+
+func (l *tLog) unexpectedError(msg string, hasErr bool) bool {
+	if !l.ctxErr && !hasErr {
+		return false
+	}
+	for _, exp := range l.s.expectedErrors {
+		if strings.Contains(msg, exp) {
+			return false
+		}
+	}
+	return true
 }
 
 // IsDebug returns true if Debug level is enabled
 func (l *tLog) IsDebug() bool {
-	return true
+	return l.s.level <= LevelDebug
 }
 
 // IsInfo returns true if Info level is enabled
 func (l *tLog) IsInfo() bool {
-	return true
+	return l.s.level <= LevelInfo
 }
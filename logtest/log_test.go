@@ -16,7 +16,12 @@ package logtest
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
 	"testing"
 
 	"github.com/corestoreio/log"
@@ -48,3 +53,152 @@ func TestNewLogger(t *testing.T) {
 	assert.Exactly(t, "[INFO] Hello newLogger: 123456 key1: \"val1\"\n[DEBUG] Hallo newLogger: 123456 key2: \"val2\"\n",
 		buf.String())
 }
+
+// mockTB implements the functions of testing.TB used by the options.
+type mockTB struct {
+	mockLog
+	errs     []string
+	cleanups []func()
+	failed   bool
+}
+
+func (tb *mockTB) Errorf(format string, args ...interface{}) {
+	tb.errs = append(tb.errs, fmt.Sprintf(format, args...))
+	tb.failed = true
+}
+
+func (tb *mockTB) Cleanup(fn func()) { tb.cleanups = append(tb.cleanups, fn) }
+
+func (tb *mockTB) Failed() bool { return tb.failed }
+
+func (tb *mockTB) runCleanups() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+func TestNewWithOptions_Level(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	l := NewWithOptions(mockLog{buf}, WithLevel(LevelInfo), WithFields(log.Int("n", 1)))
+	assert.False(t, l.IsDebug())
+	assert.True(t, l.IsInfo())
+	l.Debug("Hallo")
+	l.Info("Hello")
+	assert.Exactly(t, "[INFO] Hello n: 1\n", buf.String())
+}
+
+func TestNewWithOptions_FailOnError(t *testing.T) {
+	t.Parallel()
+
+	tb := &mockTB{mockLog: mockLog{new(bytes.Buffer)}}
+	l := NewWithOptions(tb, WithFailOnError("retry"))
+	l.Info("ok", log.Err(nil))
+	l.Info("retry failed", log.Err(errors.New("timeout")))
+	assert.Exactly(t, 0, len(tb.errs))
+	l.With(log.Int("n", 1)).Debug("query failed", log.Fields{log.Err(errors.New("timeout"))})
+	assert.Exactly(t, []string{"[logtest] Unexpected error logged: [DEBUG] query failed n: 1 error: \"timeout\"\n"}, tb.errs)
+
+	tb.errs = nil
+	l.With(log.Err(errors.New("conn lost"))).Info("request", log.Int("status", 500))
+	assert.Exactly(t, []string{"[logtest] Unexpected error logged: [INFO] request error: \"conn lost\" status: 500\n"}, tb.errs)
+}
+
+// helperProcessEnv runs TestNewWithOptions_Helper as the child process which
+// logs with a real testing.T.
+const helperProcessEnv = "LOGTEST_HELPER_PROCESS"
+
+func TestNewWithOptions_Helper(t *testing.T) {
+	if os.Getenv(helperProcessEnv) == "1" {
+		l := NewWithOptions(t, WithHelper())
+		_, _, line, _ := runtime.Caller(0)
+		l.Info("info", log.Int("line", line+1))
+		_, _, line, _ = runtime.Caller(0)
+		l.With(log.Bool("with", true)).Debug("debug", log.Int("line", line+1))
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestNewWithOptions_Helper$", "-test.v")
+	cmd.Env = append(os.Environ(), helperProcessEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, "%s", out)
+
+	matches := regexp.MustCompile(`log_test\.go:(\d+): \[(?:INFO|DEBUG)\] .* line: (\d+)`).FindAllStringSubmatch(string(out), -1)
+	assert.Len(t, matches, 2, "%s", out)
+	for _, m := range matches {
+		assert.Exactly(t, m[2], m[1], "Must report the line of the caller: %s", m[0])
+	}
+}
+
+func TestNewWithOptions_FailOnError_EvaluatesOnce(t *testing.T) {
+	t.Parallel()
+
+	tb := &mockTB{mockLog: mockLog{new(bytes.Buffer)}}
+	l := NewWithOptions(tb, WithFailOnError())
+	var calls int
+	l.Info("request", log.StringFn("fn", func(add log.AddStringFn) error {
+		calls++
+		if calls > 1 {
+			return errors.New("evaluated twice")
+		}
+		add("fn", "once")
+		return nil
+	}))
+	assert.Exactly(t, 1, calls, "The fields must be evaluated only once per log call")
+	assert.Exactly(t, "[INFO] request fn: \"once\"\n", tb.String())
+	assert.Empty(t, tb.errs)
+
+	l.Info("failed", log.StringFn("fn", func(log.AddStringFn) error {
+		return errors.New("fn failed")
+	}))
+	assert.Len(t, tb.errs, 1)
+	assert.Contains(t, tb.errs[0], "[INFO] failed error: fn failed")
+}
+
+func TestNewWithOptions_PrintOnFailure(t *testing.T) {
+	t.Parallel()
+
+	tb := &mockTB{mockLog: mockLog{new(bytes.Buffer)}}
+	l := NewWithOptions(tb, WithPrintOnFailure())
+	l.Info("Hello")
+	tb.runCleanups()
+	assert.Exactly(t, "", tb.String(), "Passed tests must not print")
+
+	tb = &mockTB{mockLog: mockLog{new(bytes.Buffer)}}
+	l = NewWithOptions(tb, WithPrintOnFailure())
+	l.Info("Hello")
+	l.Debug("Hallo")
+	assert.Exactly(t, "", tb.String())
+	tb.failed = true
+	tb.runCleanups()
+	assert.Exactly(t, "[INFO] Hello\n[DEBUG] Hallo\n", tb.String())
+}
+
+type syncLog struct {
+	buf log.MutexBuffer
+}
+
+func (sl *syncLog) Log(args ...interface{}) {
+	fmt.Fprint(&sl.buf, args...)
+}
+
+func TestConformance(t *testing.T) {
+	Conformance(t, func(t testing.TB, lvl Level) (log.Logger, func() Entries) {
+		sl := new(syncLog)
+		return NewWithOptions(sl, WithLevel(lvl)), func() Entries {
+			return DecodeText(t, sl.buf.Bytes(), map[string]Level{
+				"[DEBUG] ": LevelDebug,
+				"[INFO] ":  LevelInfo,
+			})
+		}
+	})
+}
+
+type discardLog struct{}
+
+func (discardLog) Log(args ...interface{}) {}
+
+func BenchmarkLog_With(b *testing.B) {
+	BenchmarkWith(b, New(discardLog{}))
+}
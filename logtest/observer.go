@@ -0,0 +1,333 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/log"
+)
+
+// Level defines the level of an Entry.
+type Level uint8
+
+// Level* constants define the available levels.
+const (
+	LevelDebug Level = iota + 1
+	LevelInfo
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	}
+	return fmt.Sprintf("Level(%d)", uint8(l))
+}
+
+// Field represents a typed key-value pair as added to a log.KeyValuer. The
+// Value has the type of the Add* function: bool, float64, int, int64,
+// uint64, string or the object of AddObject. Marshalers and nested fields
+// have the type []Field.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Entry represents a recorded log entry.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	// Context contains the fields added by With.
+	Context []Field
+	// Fields contains the fields of the logging call.
+	Fields []Field
+}
+
+// AllFields returns the Context and the Fields.
+func (e Entry) AllFields() []Field {
+	return append(e.Context[:len(e.Context):len(e.Context)], e.Fields...)
+}
+
+// Field returns the value of the last field with the key, searching Context
+// and Fields.
+func (e Entry) Field(key string) (interface{}, bool) {
+	all := e.AllFields()
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].Key == key {
+			return all[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// String returns the entry in the format of log.Fields.ToString.
+func (e Entry) String() string {
+	var buf strings.Builder
+	buf.WriteString(e.Level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(e.Message)
+	writeFields(&buf, e.AllFields())
+	return buf.String()
+}
+
+func writeFields(buf *strings.Builder, fs []Field) {
+	for _, f := range fs {
+		buf.WriteString(log.Separator)
+		buf.WriteString(f.Key)
+		buf.WriteString(log.AssignmentChar)
+		if nested, ok := f.Value.([]Field); ok {
+			buf.WriteByte('{')
+			writeFields(buf, nested)
+			buf.WriteString(" }")
+			continue
+		}
+		switch f.Value.(type) {
+		case uint, uint8, uint16, uint32, uint64:
+			fmt.Fprintf(buf, "%d", f.Value)
+		default:
+			fmt.Fprintf(buf, "%#v", f.Value)
+		}
+	}
+}
+
+// Entries provides query functions for recorded entries.
+type Entries []Entry
+
+// Len returns the number of entries.
+func (es Entries) Len() int {
+	return len(es)
+}
+
+// Filter returns the entries for which fn returns true.
+func (es Entries) Filter(fn func(Entry) bool) Entries {
+	var filtered Entries
+	for _, e := range es {
+		if fn(e) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// FilterLevel returns the entries with the level.
+func (es Entries) FilterLevel(l Level) Entries {
+	return es.Filter(func(e Entry) bool { return e.Level == l })
+}
+
+// FilterMessage returns the entries with exactly the message.
+func (es Entries) FilterMessage(msg string) Entries {
+	return es.Filter(func(e Entry) bool { return e.Message == msg })
+}
+
+// FilterMessageSnippet returns the entries whose message contains the
+// snippet.
+func (es Entries) FilterMessageSnippet(snippet string) Entries {
+	return es.Filter(func(e Entry) bool { return strings.Contains(e.Message, snippet) })
+}
+
+// FilterField returns the entries which contain a field with the key and the
+// value. Integers match independent of their type, so FilterField("id", 42)
+// finds log.Int64("id", 42) and log.Uint64("id", 42).
+func (es Entries) FilterField(key string, value interface{}) Entries {
+	return es.Filter(func(e Entry) bool {
+		for _, f := range e.AllFields() {
+			if f.Key == key && equalValue(f.Value, value) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func equalValue(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ai, aSigned, aOK := toInteger(a)
+	bi, bSigned, bOK := toInteger(b)
+	if !aOK || !bOK {
+		return false
+	}
+	if aSigned != bSigned && (int64(ai) < 0 || int64(bi) < 0) {
+		return false
+	}
+	return ai == bi
+}
+
+// toInteger converts all integer types into their uint64 bit pattern.
+func toInteger(v interface{}) (u uint64, signed bool, ok bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()), true, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), false, true
+	}
+	return 0, false, false
+}
+
+type observerState struct {
+	mu      sync.Mutex
+	entries Entries
+}
+
+// Observer records structured log entries for assertions in tests, similar to
+// zaptest/observer. Debug and Info are always enabled. Loggers created by With
+// share the recorded entries. Observer is safe for concurrent use.
+type Observer struct {
+	s *observerState
+	// ctx is only set when we act as a child logger
+	ctx []Field
+}
+
+// NewObserver creates a new Observer.
+func NewObserver() *Observer {
+	return &Observer{s: new(observerState)}
+}
+
+// With returns a new Logger that has this logger's context plus the given
+// Fields. The new Logger shares the recorded entries.
+func (o *Observer) With(fields ...log.Field) log.Logger {
+	o2 := new(Observer)
+	*o2 = *o
+	o2.ctx = append(o2.ctx[:len(o2.ctx):len(o2.ctx)], collectFields(fields)...)
+	return o2
+}
+
+// Debug records a debug entry.
+func (o *Observer) Debug(msg string, fields ...log.Field) {
+	o.record(LevelDebug, msg, fields)
+}
+
+// Info records an info entry.
+func (o *Observer) Info(msg string, fields ...log.Field) {
+	o.record(LevelInfo, msg, fields)
+}
+
+// IsDebug returns always true.
+func (o *Observer) IsDebug() bool { return true }
+
+// IsInfo returns always true.
+func (o *Observer) IsInfo() bool { return true }
+
+func (o *Observer) record(level Level, msg string, fields log.Fields) {
+	e := Entry{
+		Time:    log.Now(),
+		Level:   level,
+		Message: msg,
+		Context: o.ctx,
+		Fields:  collectFields(fields),
+	}
+	o.s.mu.Lock()
+	o.s.entries = append(o.s.entries, e)
+	o.s.mu.Unlock()
+}
+
+// All returns a copy of all recorded entries.
+func (o *Observer) All() Entries {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	return append(Entries(nil), o.s.entries...)
+}
+
+// TakeAll returns all recorded entries and removes them from the Observer.
+func (o *Observer) TakeAll() Entries {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	es := o.s.entries
+	o.s.entries = nil
+	return es
+}
+
+// Len returns the number of recorded entries.
+func (o *Observer) Len() int {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	return len(o.s.entries)
+}
+
+// FilterMessage returns the recorded entries with exactly the message.
+func (o *Observer) FilterMessage(msg string) Entries {
+	return o.All().FilterMessage(msg)
+}
+
+// FilterField returns the recorded entries which contain a field with the key
+// and the value. See Entries.FilterField.
+func (o *Observer) FilterField(key string, value interface{}) Entries {
+	return o.All().FilterField(key, value)
+}
+
+type errorReporter interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertLogged reports an error to t if no entry with the message and all the
+// fields has been recorded. It returns whether such an entry exists.
+//
+//	obs.AssertLogged(t, "user created", log.Int("user_id", 42))
+func (o *Observer) AssertLogged(t errorReporter, msg string, fields ...log.Field) bool {
+	t.Helper()
+	es := o.All()
+	found := es.FilterMessage(msg)
+	for _, f := range collectFields(fields) {
+		found = found.FilterField(f.Key, f.Value)
+	}
+	if len(found) > 0 {
+		return true
+	}
+	var want, recorded strings.Builder
+	writeFields(&want, collectFields(fields))
+	for _, e := range es {
+		recorded.WriteString("\n\t")
+		recorded.WriteString(e.String())
+	}
+	t.Errorf("[logtest] No entry logged with message %q and fields%s\nRecorded entries:%s",
+		msg, want.String(), recorded.String())
+	return false
+}
+
+// collectFields evaluates the fields once with log.Capture and converts them
+// into typed key-value pairs.
+func collectFields(fields log.Fields) []Field {
+	captured, _ := log.Capture(fields...)
+	return capturedFields(captured)
+}
+
+func capturedFields(captured log.Fields) []Field {
+	if len(captured) == 0 {
+		return nil
+	}
+	fs := make([]Field, 0, len(captured))
+	for _, f := range captured {
+		key, value, ok := log.CapturedValue(f)
+		if !ok {
+			continue
+		}
+		if nested, ok := value.(log.Fields); ok {
+			value = capturedFields(nested)
+		}
+		fs = append(fs, Field{Key: key, Value: value})
+	}
+	return fs
+}
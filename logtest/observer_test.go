@@ -0,0 +1,111 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ log.Logger = (*Observer)(nil)
+
+type mockReporter struct {
+	errs []string
+}
+
+func (mr *mockReporter) Helper() {}
+
+func (mr *mockReporter) Errorf(format string, args ...interface{}) {
+	mr.errs = append(mr.errs, fmt.Sprintf(format, args...))
+}
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+
+	obs := NewObserver()
+	l := obs.With(log.String("request_id", "r1"))
+	l.Info("user created", log.Int("user_id", 42), log.Bool("admin", false))
+	l.Debug("query", log.Uint64("rows", 3), log.Nest("db", log.String("table", "users")), log.Err(errors.New("slow")))
+	obs.Info("user created", log.Int64("user_id", 43))
+
+	assert.Exactly(t, 3, obs.Len())
+	es := obs.All()
+	assert.Exactly(t, LevelInfo, es[0].Level)
+	assert.Exactly(t, []Field{{"request_id", "r1"}}, es[0].Context)
+	assert.Exactly(t, []Field{{"user_id", 42}, {"admin", false}}, es[0].Fields)
+	assert.Exactly(t, []Field{
+		{"rows", uint64(3)},
+		{"db", []Field{{"table", "users"}}},
+		{"error", "slow"},
+	}, es[1].Fields)
+	v, ok := es[1].Field("request_id")
+	assert.True(t, ok)
+	assert.Exactly(t, "r1", v)
+	assert.Exactly(t, `DEBUG query request_id: "r1" rows: 3 db: { table: "users" } error: "slow"`, es[1].String())
+
+	assert.Exactly(t, 2, obs.FilterMessage("user created").Len())
+	assert.Exactly(t, 1, obs.FilterField("user_id", 42).Len())
+	assert.Exactly(t, 1, obs.FilterField("user_id", uint8(43)).Len())
+	assert.Exactly(t, 2, obs.FilterField("request_id", "r1").Len())
+	assert.Exactly(t, 1, obs.All().FilterLevel(LevelDebug).FilterMessageSnippet("que").Len())
+	assert.Exactly(t, 0, obs.FilterField("user_id", "42").Len())
+
+	assert.True(t, obs.AssertLogged(t, "user created", log.Int("user_id", 42), log.String("request_id", "r1")))
+	mr := &mockReporter{}
+	assert.False(t, obs.AssertLogged(mr, "user created", log.Int("user_id", 44)))
+	assert.Exactly(t, 1, len(mr.errs))
+	assert.Contains(t, mr.errs[0], `No entry logged with message "user created" and fields user_id: 44`)
+	assert.Contains(t, mr.errs[0], "\n\tINFO user created user_id: 43")
+
+	assert.Exactly(t, 3, obs.TakeAll().Len())
+	assert.Exactly(t, 0, obs.Len())
+}
+
+type failingMarshaler struct{ calls *int }
+
+func (fm failingMarshaler) MarshalLog(kv log.KeyValuer) error {
+	*fm.calls++
+	kv.AddInt("hits", 3)
+	return errors.New("miss")
+}
+
+func TestObserver_Errors(t *testing.T) {
+	t.Parallel()
+
+	obs := NewObserver()
+	var calls int
+	l := obs.With(log.Marshal("cache", failingMarshaler{calls: &calls}))
+	l.Info("first")
+	l.Info("second", log.StringFn("fn", func(log.AddStringFn) error { return errors.New("fn failed") }), log.Int("n", 1))
+	assert.Exactly(t, 1, calls, "With must evaluate the fields once")
+
+	es := obs.All()
+	assert.Exactly(t, []Field{{"cache", []Field{{"hits", 3}, {"error", "miss"}}}}, es[1].Context)
+	assert.Len(t, es[1].Fields, 1, "The fields after the failing one must be skipped like log.Capture does")
+	assert.Exactly(t, "error", es[1].Fields[0].Key)
+	assert.Contains(t, es[1].Fields[0].Value, "fn failed")
+}
+
+func TestEqualValue(t *testing.T) {
+	t.Parallel()
+	assert.True(t, equalValue(int64(-1), -1))
+	assert.False(t, equalValue(int64(-1), uint64(1<<64-1)))
+	assert.True(t, equalValue(uint64(7), 7))
+	assert.False(t, equalValue(7.0, 7))
+}
@@ -0,0 +1,40 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logw_test
+
+import (
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logtest"
+	"github.com/corestoreio/log/logw"
+)
+
+func TestConformance(t *testing.T) {
+	logtest.Conformance(t, func(t testing.TB, lvl logtest.Level) (log.Logger, func() logtest.Entries) {
+		level := logw.LevelInfo
+		if lvl == logtest.LevelDebug {
+			level = logw.LevelDebug
+		}
+		buf := new(log.MutexBuffer)
+		l := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(level), logw.WithFlag(0))
+		return l, func() logtest.Entries {
+			return logtest.DecodeText(t, buf.Bytes(), map[string]logtest.Level{
+				"DEBUG ": logtest.LevelDebug,
+				"INFO ":  logtest.LevelInfo,
+			})
+		}
+	})
+}
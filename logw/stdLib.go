@@ -39,8 +39,9 @@ type Log struct {
 	flag  int // global flag http://golang.org/pkg/log/#pkg-constants
 	debug *std.Logger
 	info  *std.Logger
-	// ctx is only set when we act as a child logger
-	ctx log.Fields
+	// ctx contains the encoded fields of With and WithFields, see
+	// log.Fields.Encode.
+	ctx string
 }
 
 // Option can be used as an argument in NewLog to configure a standard logger.
@@ -109,16 +110,18 @@ func WithInfo(out io.Writer, prefix string, flag int) Option {
 // WithFields adds fields as a logging prefix to the internal stack.
 func WithFields(fields ...log.Field) Option {
 	return func(l *Log) {
-		l.ctx = append(l.ctx, fields...)
+		l.ctx += log.Fields(fields).Encode()
 	}
 }
 
 // With creates a new inherited and shallow copied Logger with additional fields
-// added to the logging context.
+// added to the logging context. The fields get encoded only once, so they do
+// not cost anything in later Debug or Info calls. StringFn and Marshaler
+// fields run at this point, see log.Logger.With.
 func (l *Log) With(fields ...log.Field) log.Logger {
 	l2 := new(Log)
 	*l2 = *l
-	l2.ctx = append(l2.ctx, fields...)
+	l2.ctx += log.Fields(fields).Encode()
 	return l2
 }
 
@@ -134,20 +137,13 @@ func (l *Log) Info(msg string, fields ...log.Field) {
 
 // log logs a leveled entry. Panics if an unknown level has been provided.
 func (l *Log) log(level int, msg string, fs log.Fields) {
-	if ctxl := len(l.ctx); ctxl > 0 {
-		all := make(log.Fields, 0, ctxl+len(fs))
-		all = append(all, l.ctx...)
-		all = append(all, fs...)
-		fs = all
-	}
-
 	if l.level >= level {
 		switch level {
 		case LevelDebug:
 			// l.debug.Print(stdFormat(msg, append(args, "in", getStackTrace())))
-			l.debug.Print(fs.ToString(msg))
+			l.debug.Print(fs.ToStringEncoded(msg, l.ctx))
 		case LevelInfo:
-			l.info.Print(fs.ToString(msg))
+			l.info.Print(fs.ToStringEncoded(msg, l.ctx))
 		default:
 			panic("[logw] Unknown Log Level")
 		}
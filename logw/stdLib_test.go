@@ -16,12 +16,15 @@ package logw_test
 
 import (
 	"bytes"
+	"io/ioutil"
 	std "log"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logtest"
 	"github.com/corestoreio/log/logw"
 	"github.com/corestoreio/pkg/util/assert"
 )
@@ -182,3 +185,21 @@ func TestLog_With(t *testing.T) {
 	pLog.Info("Parent Info", log.Int("parent_info2", 457))
 	assert.Contains(t, buf.String(), `Parent Info parent_info1_level: 2 parent_info2: 457`)
 }
+
+func TestStdLog_Golden(t *testing.T) {
+	g := logtest.NewGolden(t, "stdlog")
+	l := logw.NewLog(
+		logw.WithWriter(g),
+		logw.WithLevel(logw.LevelDebug),
+		logw.WithFlag(std.LstdFlags|std.Lmicroseconds|std.Lshortfile),
+	).With(log.String("service", "checkout"))
+
+	l.Info("Order placed", log.Int64("order_id", 4711), log.Float64("total", 99.95),
+		log.Nest("customer", log.String("email", "a@b.c"), log.Bool("guest", true)))
+	l.Debug("Payment request", log.Stringer("took", 1500*time.Millisecond), log.Err(errors.NotFound.Newf("token")))
+	g.Assert()
+}
+
+func BenchmarkLog_With(b *testing.B) {
+	logtest.BenchmarkWith(b, logw.NewLog(logw.WithWriter(ioutil.Discard), logw.WithFlag(0)))
+}
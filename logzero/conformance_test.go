@@ -0,0 +1,38 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logzero_test
+
+import (
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logtest"
+	"github.com/corestoreio/log/logzero"
+	"github.com/rs/zerolog"
+)
+
+func TestConformance(t *testing.T) {
+	logtest.Conformance(t, func(t testing.TB, lvl logtest.Level) (log.Logger, func() logtest.Entries) {
+		level := zerolog.InfoLevel
+		if lvl == logtest.LevelDebug {
+			level = zerolog.DebugLevel
+		}
+		buf := new(log.MutexBuffer)
+		l := logzero.New(level, zerolog.New(buf).Level(level))
+		return l, func() logtest.Entries {
+			return logtest.DecodeJSON(t, buf.Bytes(), zerolog.MessageFieldName, zerolog.LevelFieldName)
+		}
+	})
+}
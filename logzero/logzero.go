@@ -25,8 +25,6 @@ import (
 type Wrap struct {
 	level  zerolog.Level
 	logger zerolog.Logger
-	// ctx is only set when we act as a child logger
-	ctx log.Fields
 }
 
 // New creates a new https://godoc.org/github.com/rs/zerolog logger.
@@ -39,54 +37,55 @@ func New(lvl zerolog.Level, zl zerolog.Logger) *Wrap {
 }
 
 // With creates a new inherited and shallow copied Logger with additional fields
-// added to the logging context.
+// added to the logging context. The fields get encoded only once into the
+// zerolog.Context of the new logger.
 func (l *Wrap) With(fields ...log.Field) log.Logger {
 	l2 := *l
-	l2.ctx = append(l2.ctx, fields...)
+	l2.logger = l.logger.With().Fields(wrapFields(fields)).Logger()
 	return &l2
 }
 
 // Info outputs information for users of the app
 func (l *Wrap) Info(msg string, fields ...log.Field) {
-	doZLFieldWrap(l.ctx, l.logger.Info(), msg, fields...)
+	doZLFieldWrap(l.logger.Info(), msg, fields)
 }
 
 // Debug outputs information for developers.
 func (l *Wrap) Debug(msg string, fields ...log.Field) {
-	doZLFieldWrap(l.ctx, l.logger.Debug(), msg, fields...)
+	doZLFieldWrap(l.logger.Debug(), msg, fields)
 }
 
 // IsDebug returns true if Debug level is enabled
 func (l *Wrap) IsDebug() bool {
-	return l.level >= zerolog.DebugLevel
+	return l.level <= zerolog.DebugLevel
 }
 
 // IsInfo returns true if Info level is enabled
 func (l *Wrap) IsInfo() bool {
-	return l.level >= zerolog.InfoLevel
+	return l.level <= zerolog.InfoLevel
 }
 
 type log15FieldWrap struct {
 	ifaces []interface{}
 }
 
-func doZLFieldWrap(ctx log.Fields, zl *zerolog.Event, msg string, fs ...log.Field) {
-	if ctxl := len(ctx); ctxl > 0 {
-		all := make(log.Fields, 0, ctxl+len(fs))
-		all = append(all, ctx...)
-		all = append(all, fs...)
-		fs = all
+// doZLFieldWrap writes the entry. A nil event means the level is disabled.
+func doZLFieldWrap(zl *zerolog.Event, msg string, fs log.Fields) {
+	if zl == nil {
+		return
 	}
+	zl.Fields(wrapFields(fs)).Msg(msg)
+}
 
+func wrapFields(fs log.Fields) []interface{} {
 	fw := &log15FieldWrap{
 		ifaces: make([]interface{}, 0, len(fs)*2),
 	}
 
-	if err := log.Fields(fs).AddTo(fw); err != nil {
+	if err := fs.AddTo(fw); err != nil {
 		fw.AddString(log.KeyNameError, fmt.Sprintf("%+v", err))
 	}
-
-	zl.Fields(fw.ifaces).Msg(msg)
+	return fw.ifaces
 }
 
 func (se *log15FieldWrap) append(key string, val interface{}) {
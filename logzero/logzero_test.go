@@ -16,11 +16,13 @@ package logzero_test
 
 import (
 	"bytes"
+	"io/ioutil"
 	"math"
 	"testing"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logtest"
 	"github.com/corestoreio/log/logzero"
 	"github.com/corestoreio/pkg/util/assert"
 	"github.com/rs/zerolog"
@@ -128,3 +130,24 @@ func TestAddMarshaler_Error(t *testing.T) {
 	assert.Contains(t, buf.String(), `"kvfloat64":0`)
 	assert.Contains(t, buf.String(), `"kvstring":""`)
 }
+
+func TestWrap_With_Siblings(t *testing.T) {
+	buf := new(bytes.Buffer)
+	parent := logzero.New(zerolog.DebugLevel, zerolog.New(buf)).With(log.String("p", "1"))
+	a := parent.With(log.String("s", "a"))
+	b := parent.With(log.String("s", "b"), log.Int("n", 2))
+	a.Info("a", log.Int("i", 1))
+	b.Debug("b")
+	parent.Info("parent")
+	a.Info("a")
+
+	assert.Exactly(t, `{"level":"info","p":"1","s":"a","i":1,"message":"a"}
+{"level":"debug","p":"1","s":"b","n":2,"message":"b"}
+{"level":"info","p":"1","message":"parent"}
+{"level":"info","p":"1","s":"a","message":"a"}
+`, buf.String())
+}
+
+func BenchmarkWrap_With(b *testing.B) {
+	logtest.BenchmarkWith(b, logzero.New(zerolog.InfoLevel, zerolog.New(ioutil.Discard)))
+}
@@ -16,15 +16,31 @@ package log
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"regexp"
+	"strings"
 	"sync"
+
+	"github.com/corestoreio/errors"
 )
 
 // MutexBuffer allows concurrent and parallel writes to a buffer. Mostly used
 // during testing when the logger should be able to accept multiple writes.
+// The WaitFor* functions block until asynchronous output has been written, so
+// tests do not need time.Sleep.
 type MutexBuffer struct {
 	mu  sync.Mutex
 	buf bytes.Buffer
+	// cond gets created lazily to keep the zero value usable.
+	cond *sync.Cond
+}
+
+// broadcast wakes up all WaitFor* calls. Must be called with an acquired lock.
+func (pl *MutexBuffer) broadcast() {
+	if pl.cond != nil {
+		pl.cond.Broadcast()
+	}
 }
 
 // Write appends the contents of p to the buffer with an acquired lock, growing
@@ -33,6 +49,7 @@ type MutexBuffer struct {
 func (pl *MutexBuffer) Write(p []byte) (n int, err error) {
 	pl.mu.Lock()
 	n, err = pl.buf.Write(p)
+	pl.broadcast()
 	pl.mu.Unlock()
 	return
 }
@@ -69,11 +86,10 @@ func (pl *MutexBuffer) Reset() {
 	pl.mu.Unlock()
 }
 
-// Reset truncates the buffer to zero length
-func (pl *MutexBuffer) Len() (l int) {
-	// locks for ever
-	// pl.mu.Lock()
-	// defer pl.mu.Unlock()
+// Len returns the number of bytes of the unread portion of the buffer.
+func (pl *MutexBuffer) Len() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
 	return pl.buf.Len()
 }
 
@@ -81,7 +97,9 @@ func (pl *MutexBuffer) Len() (l int) {
 func (pl *MutexBuffer) ReadFrom(r io.Reader) (n int64, err error) {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
-	return pl.buf.ReadFrom(r)
+	n, err = pl.buf.ReadFrom(r)
+	pl.broadcast()
+	return n, err
 }
 
 // Read @see io.Reader description
@@ -90,3 +108,86 @@ func (pl *MutexBuffer) Read(p []byte) (n int, err error) {
 	defer pl.mu.Unlock()
 	return pl.buf.Read(p)
 }
+
+// Lines returns the content of the buffer split into lines without the line
+// breaks. A trailing line break does not create an empty last line.
+func (pl *MutexBuffer) Lines() []string {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	str := strings.TrimSuffix(pl.buf.String(), "\n")
+	if str == "" {
+		return nil
+	}
+	return strings.Split(str, "\n")
+}
+
+// Count returns the number of non-overlapping occurrences of substr in the
+// buffer.
+func (pl *MutexBuffer) Count(substr string) int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return bytes.Count(pl.buf.Bytes(), []byte(substr))
+}
+
+// WaitFor blocks until the buffer contains substr or the context gets
+// cancelled.
+func (pl *MutexBuffer) WaitFor(ctx context.Context, substr string) error {
+	return errors.Wrapf(pl.wait(ctx, func(b []byte) bool {
+		return bytes.Contains(b, []byte(substr))
+	}), "[log] MutexBuffer.WaitFor %q", substr)
+}
+
+// WaitForRegexp blocks until the buffer matches the regular expression or the
+// context gets cancelled.
+func (pl *MutexBuffer) WaitForRegexp(ctx context.Context, re *regexp.Regexp) error {
+	return errors.Wrapf(pl.wait(ctx, re.Match), "[log] MutexBuffer.WaitForRegexp %q", re)
+}
+
+// WaitForN blocks until the buffer contains at least n occurrences of substr
+// or the context gets cancelled.
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	if err := buf.WaitForN(ctx, "[logmem]", 3); err != nil {
+//		t.Fatal(err)
+//	}
+func (pl *MutexBuffer) WaitForN(ctx context.Context, substr string, n int) error {
+	return errors.Wrapf(pl.wait(ctx, func(b []byte) bool {
+		return bytes.Count(b, []byte(substr)) >= n
+	}), "[log] MutexBuffer.WaitForN %q %d", substr, n)
+}
+
+// wait checks fn after each write until fn returns true or the context gets
+// cancelled.
+func (pl *MutexBuffer) wait(ctx context.Context, fn func([]byte) bool) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if fn(pl.buf.Bytes()) {
+		return nil
+	}
+	if pl.cond == nil {
+		pl.cond = sync.NewCond(&pl.mu)
+	}
+
+	// sync.Cond knows nothing about contexts, so a cancellation must wake up
+	// the waiting goroutine.
+	stop := make(chan struct{})
+	defer close(stop) // runs before the deferred Unlock
+	go func() {
+		select {
+		case <-ctx.Done():
+			pl.mu.Lock()
+			pl.cond.Broadcast()
+			pl.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	for !fn(pl.buf.Bytes()) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pl.cond.Wait()
+	}
+	return nil
+}
@@ -15,10 +15,15 @@
 package log_test
 
 import (
+	"context"
 	"io"
+	"regexp"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/corestoreio/pkg/util/assert"
 )
@@ -36,7 +41,7 @@ func TestMutexBuffer(t *testing.T) {
 	go func(t *testing.T) {
 		defer wg.Done()
 		if _, err := mb.Write([]byte(`W1`)); err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}(t)
 
@@ -44,7 +49,7 @@ func TestMutexBuffer(t *testing.T) {
 	go func(t *testing.T) {
 		defer wg.Done()
 		if _, err := mb.Write([]byte(`W2`)); err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}(t)
 	wg.Wait()
@@ -67,3 +72,60 @@ func TestMutexBuffer_Read(t *testing.T) {
 	}
 	assert.Exactly(t, `Hello Gophers`, string(p[:n]))
 }
+
+func TestMutexBuffer_Lines(t *testing.T) {
+	t.Parallel()
+
+	mb := &log.MutexBuffer{}
+	assert.Empty(t, mb.Lines())
+	assert.Exactly(t, 0, mb.Count("INFO"))
+
+	_, _ = mb.Write([]byte("INFO a\nDEBUG b\nINFO c\n"))
+	assert.Exactly(t, []string{"INFO a", "DEBUG b", "INFO c"}, mb.Lines())
+	assert.Exactly(t, 2, mb.Count("INFO"))
+
+	_, _ = mb.Write([]byte("\npartial"))
+	assert.Exactly(t, []string{"INFO a", "DEBUG b", "INFO c", "", "partial"}, mb.Lines())
+}
+
+func TestMutexBuffer_WaitFor(t *testing.T) {
+	t.Parallel()
+
+	mb := &log.MutexBuffer{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			_, _ = mb.Write([]byte("INFO tick " + strconv.Itoa(i) + "\n"))
+		}
+		_, _ = mb.Write([]byte("INFO done\n"))
+	}()
+
+	assert.NoError(t, mb.WaitForN(ctx, "tick", 5))
+	assert.NoError(t, mb.WaitForRegexp(ctx, regexp.MustCompile(`tick \d+\n`)))
+	assert.NoError(t, mb.WaitFor(ctx, "INFO done"))
+	assert.Exactly(t, 6, len(mb.Lines()))
+
+	// Already satisfied conditions return immediately.
+	assert.NoError(t, mb.WaitFor(ctx, "tick 0"))
+}
+
+func TestMutexBuffer_WaitFor_Cancel(t *testing.T) {
+	t.Parallel()
+
+	mb := &log.MutexBuffer{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		_, _ = mb.Write([]byte("INFO something else\n"))
+	}()
+
+	err := mb.WaitForN(ctx, "never", 1)
+	assert.True(t, errors.Cause(err) == context.DeadlineExceeded, "%+v", err)
+	assert.Contains(t, err.Error(), `[log] MutexBuffer.WaitForN "never" 1`)
+
+	err = mb.WaitFor(ctx, "never")
+	assert.True(t, errors.Cause(err) == context.DeadlineExceeded, "%+v", err)
+}
@@ -0,0 +1,278 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// RecordedEntry represents an entry of the Recorder.
+type RecordedEntry struct {
+	Time    time.Time
+	Level   string // "DEBUG" or "INFO"
+	Message string
+	// Fields contains the encoded fields in the format of Fields.ToString,
+	// starting with a separator.
+	Fields string
+}
+
+// size returns the approximate memory size of the entry.
+func (e RecordedEntry) size() int {
+	return len(e.Message) + len(e.Fields) + 48
+}
+
+// appendTo appends the entry as a line: time, level, message and fields.
+func (e RecordedEntry) appendTo(buf []byte) []byte {
+	buf = e.Time.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, ' ')
+	buf = append(buf, e.Level...)
+	buf = append(buf, ' ')
+	buf = append(buf, e.Message...)
+	buf = append(buf, e.Fields...)
+	return append(buf, '\n')
+}
+
+type recorderState struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	// entries is a ring buffer with n entries in use, the oldest at start.
+	// It grows up to maxEntries and then gets overwritten.
+	entries []RecordedEntry
+	start   int
+	n       int
+	bytes   int
+}
+
+// Recorder acts as a flight recorder which keeps the last N entries, or the
+// last N bytes of entries, of all levels in memory. The fields get encoded
+// while logging, outside of the lock. Use Tee to record alongside a
+// production logger, so the recent debug history can be dumped when the
+// program crashes, even if only Info entries get shipped. Loggers created by
+// With share the buffer. Recorder is safe for concurrent use. loghttp.Tail
+// keeps structured entries instead, to filter and stream them via HTTP.
+type Recorder struct {
+	s *recorderState
+	// ctx contains the encoded fields of With, see Fields.Encode.
+	ctx string
+}
+
+// RecorderOption can be used as an argument in NewRecorder to configure the
+// Recorder.
+type RecorderOption func(*recorderState)
+
+// WithRecorderEntries limits the amount of recorded entries. Defaults to 1000
+// if no limit of bytes has been set.
+func WithRecorderEntries(n int) RecorderOption {
+	return func(s *recorderState) {
+		s.maxEntries = n
+	}
+}
+
+// WithRecorderBytes limits the approximate memory size of all recorded
+// entries. Zero means unlimited, which is the default.
+func WithRecorderBytes(n int) RecorderOption {
+	return func(s *recorderState) {
+		s.maxBytes = n
+	}
+}
+
+// NewRecorder creates a new flight recorder. If neither a limit of entries
+// nor of bytes has been set, the Recorder keeps the last 1000 entries.
+func NewRecorder(opts ...RecorderOption) *Recorder {
+	s := new(recorderState)
+	for _, o := range opts {
+		o(s)
+	}
+	if s.maxEntries <= 0 && s.maxBytes <= 0 {
+		s.maxEntries = 1000
+	}
+	return &Recorder{s: s}
+}
+
+// With returns a new Logger that has this logger's context plus the given
+// Fields. The new Logger shares the buffer.
+func (r *Recorder) With(fields ...Field) Logger {
+	r2 := new(Recorder)
+	*r2 = *r
+	r2.ctx += Fields(fields).Encode()
+	return r2
+}
+
+// Debug records a debug entry.
+func (r *Recorder) Debug(msg string, fields ...Field) {
+	r.record("DEBUG", msg, fields)
+}
+
+// Info records an info entry.
+func (r *Recorder) Info(msg string, fields ...Field) {
+	r.record("INFO", msg, fields)
+}
+
+// IsDebug returns always true.
+func (r *Recorder) IsDebug() bool { return true }
+
+// IsInfo returns always true.
+func (r *Recorder) IsInfo() bool { return true }
+
+func (r *Recorder) record(level, msg string, fields Fields) {
+	e := RecordedEntry{
+		Time:    Now(),
+		Level:   level,
+		Message: msg,
+	}
+	e.Fields = r.ctx
+	if len(fields) > 0 {
+		e.Fields = strings.TrimSuffix(fields.ToStringEncoded("", r.ctx), "\n")
+	}
+
+	s := r.s
+	s.mu.Lock()
+	s.push(e)
+	s.mu.Unlock()
+}
+
+// push appends e and evicts the oldest entries which exceed the limits. The
+// newest entry gets always kept.
+func (s *recorderState) push(e RecordedEntry) {
+	if s.n == len(s.entries) {
+		if s.maxEntries > 0 && s.n >= s.maxEntries {
+			s.pop()
+		} else {
+			s.grow()
+		}
+	}
+	s.entries[(s.start+s.n)%len(s.entries)] = e
+	s.n++
+	s.bytes += e.size()
+	for s.n > 1 && s.maxBytes > 0 && s.bytes > s.maxBytes {
+		s.pop()
+	}
+}
+
+// pop removes the oldest entry.
+func (s *recorderState) pop() {
+	s.bytes -= s.entries[s.start].size()
+	s.entries[s.start] = RecordedEntry{}
+	s.start = (s.start + 1) % len(s.entries)
+	s.n--
+}
+
+// grow doubles the capacity of the ring, limited by maxEntries.
+func (s *recorderState) grow() {
+	c := 2 * len(s.entries)
+	if c < 16 {
+		c = 16
+	}
+	if s.maxEntries > 0 && c > s.maxEntries {
+		c = s.maxEntries
+	}
+	entries := make([]RecordedEntry, c)
+	s.copyTo(entries)
+	s.entries = entries
+	s.start = 0
+}
+
+// copyTo copies the entries in use to dst, oldest first.
+func (s *recorderState) copyTo(dst []RecordedEntry) {
+	if s.start+s.n <= len(s.entries) {
+		copy(dst, s.entries[s.start:s.start+s.n])
+		return
+	}
+	m := copy(dst, s.entries[s.start:])
+	copy(dst[m:], s.entries[:s.n-m])
+}
+
+// Snapshot returns a copy of the recorded entries, oldest first.
+func (r *Recorder) Snapshot() []RecordedEntry {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.s.n == 0 {
+		return nil
+	}
+	es := make([]RecordedEntry, r.s.n)
+	r.s.copyTo(es)
+	return es
+}
+
+// Reset removes all recorded entries.
+func (r *Recorder) Reset() {
+	r.s.mu.Lock()
+	r.s.entries = nil
+	r.s.start = 0
+	r.s.n = 0
+	r.s.bytes = 0
+	r.s.mu.Unlock()
+}
+
+// WriteTo writes the recorded entries line by line to w, oldest first. It
+// implements io.WriterTo.
+func (r *Recorder) WriteTo(w io.Writer) (int64, error) {
+	var buf []byte
+	for _, e := range r.Snapshot() {
+		buf = e.appendTo(buf)
+	}
+	n, err := w.Write(buf)
+	return int64(n), errors.WithStack(err)
+}
+
+// DumpOnPanic writes the recorded entries to w if the program panics and
+// continues panicking afterwards. It must be called directly by defer:
+//
+//	defer rec.DumpOnPanic(os.Stderr)
+func (r *Recorder) DumpOnPanic(w io.Writer) {
+	if rec := recover(); rec != nil {
+		_, _ = io.WriteString(w, "[log] Recorder dump on panic\n")
+		_, _ = r.WriteTo(w)
+		panic(rec)
+	}
+}
+
+// DumpOnSignal writes the recorded entries to w each time the process
+// receives one of the signals, for example syscall.SIGUSR1. The returned
+// function stops listening. Without signals nothing gets dumped.
+func (r *Recorder) DumpOnSignal(w io.Writer, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		// signal.Notify would relay all signals.
+		return func() {}
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				_, _ = r.WriteTo(w)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
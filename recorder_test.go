@@ -0,0 +1,224 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/log/logw"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ log.Logger = (*log.Recorder)(nil)
+
+func withNow(t time.Time) func() {
+	now := log.Now
+	log.Now = func() time.Time { return t }
+	return func() { log.Now = now }
+}
+
+func TestRecorder_Entries(t *testing.T) {
+	defer withNow(time.Date(2017, 3, 4, 5, 6, 7, 8, time.UTC))()
+
+	rec := log.NewRecorder(log.WithRecorderEntries(3))
+	l := rec.With(log.String("user", "alice"))
+	for i := 1; i <= 5; i++ {
+		l.Debug("entry", log.Int("i", i))
+	}
+	rec.Info("done")
+
+	snap := rec.Snapshot()
+	assert.Exactly(t, 3, len(snap))
+	assert.Exactly(t, log.RecordedEntry{
+		Time:    time.Date(2017, 3, 4, 5, 6, 7, 8, time.UTC),
+		Level:   "DEBUG",
+		Message: "entry",
+		Fields:  ` user: "alice" i: 4`,
+	}, snap[0])
+
+	buf := new(bytes.Buffer)
+	n, err := rec.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Exactly(t, int64(buf.Len()), n)
+	assert.Exactly(t, "2017-03-04T05:06:07.000000008Z DEBUG entry user: \"alice\" i: 4\n"+
+		"2017-03-04T05:06:07.000000008Z DEBUG entry user: \"alice\" i: 5\n"+
+		"2017-03-04T05:06:07.000000008Z INFO done\n", buf.String())
+
+	rec.Reset()
+	assert.Exactly(t, 0, len(rec.Snapshot()))
+}
+
+func TestRecorder_Bytes(t *testing.T) {
+	rec := log.NewRecorder(log.WithRecorderBytes(500))
+	for i := 0; i < 1000; i++ {
+		rec.Info(strings.Repeat("x", 90), log.Int("i", i))
+	}
+	snap := rec.Snapshot()
+	assert.True(t, len(snap) > 1 && len(snap) < 5, "Entries: %d", len(snap))
+	assert.Exactly(t, " i: 999", snap[len(snap)-1].Fields)
+
+	// a single entry larger than the limit gets kept
+	rec.Info(strings.Repeat("y", 1000))
+	assert.Exactly(t, 1, len(rec.Snapshot()))
+}
+
+func TestRecorder_Ring(t *testing.T) {
+	rec := log.NewRecorder(log.WithRecorderEntries(40))
+	for i := 0; i < 100; i++ {
+		rec.Info("entry", log.Int("i", i))
+	}
+	snap := rec.Snapshot()
+	assert.Exactly(t, 40, len(snap))
+	for j, e := range snap {
+		assert.Exactly(t, " i: "+strconv.Itoa(60+j), e.Fields)
+	}
+
+	// The byte limit evicts from the same ring, also after it wrapped around.
+	rec = log.NewRecorder(log.WithRecorderEntries(20), log.WithRecorderBytes(700))
+	for i := 0; i < 30; i++ {
+		rec.Info("entry", log.Int("i", i))
+	}
+	rec.Info(strings.Repeat("x", 500), log.Int("i", 30))
+	snap = rec.Snapshot()
+	assert.True(t, len(snap) > 1 && len(snap) < 5, "Entries: %d", len(snap))
+	assert.Exactly(t, " i: 30", snap[len(snap)-1].Fields)
+	assert.Exactly(t, " i: "+strconv.Itoa(31-len(snap)), snap[0].Fields)
+}
+
+func TestRecorder_Concurrent(t *testing.T) {
+	rec := log.NewRecorder(log.WithRecorderEntries(50))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			l := rec.With(log.Int("g", g))
+			for i := 0; i < 100; i++ {
+				l.Debug("entry", log.String("i", strconv.Itoa(i)))
+				_ = rec.Snapshot()
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Exactly(t, 50, len(rec.Snapshot()))
+}
+
+func TestRecorder_DumpOnPanic(t *testing.T) {
+	rec := log.NewRecorder()
+	buf := new(bytes.Buffer)
+	assert.Panics(t, func() {
+		defer rec.DumpOnPanic(buf)
+		rec.Debug("before crash")
+		panic("boom")
+	})
+	assert.Contains(t, buf.String(), "[log] Recorder dump on panic\n")
+	assert.Contains(t, buf.String(), " DEBUG before crash\n")
+
+	buf.Reset()
+	func() {
+		defer rec.DumpOnPanic(buf)
+	}()
+	assert.Empty(t, buf.String())
+}
+
+func TestRecorder_DumpOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Signals cannot be sent on windows")
+	}
+	rec := log.NewRecorder()
+	rec.Debug("history")
+	var buf log.MutexBuffer
+	stop := rec.DumpOnSignal(&buf, os.Interrupt)
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	assert.NoError(t, err)
+	assert.NoError(t, p.Signal(os.Interrupt))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), "DEBUG history") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Contains(t, buf.String(), "DEBUG history\n")
+	stop()
+}
+
+func TestTee(t *testing.T) {
+	buf := new(bytes.Buffer)
+	prod := logw.NewLog(logw.WithWriter(buf), logw.WithLevel(logw.LevelInfo), logw.WithFlag(0))
+	rec := log.NewRecorder()
+
+	lg := log.Tee(prod, rec).With(log.Int("n", 1))
+	assert.True(t, lg.IsDebug())
+	assert.True(t, lg.IsInfo())
+	lg.Debug("details")
+	lg.Info("summary")
+
+	assert.Exactly(t, "INFO summary n: 1\n", buf.String())
+	snap := rec.Snapshot()
+	assert.Exactly(t, 2, len(snap))
+	assert.Exactly(t, "details", snap[0].Message)
+	assert.Exactly(t, " n: 1", snap[0].Fields)
+
+	assert.False(t, log.Tee(prod).IsDebug())
+	assert.False(t, log.Tee().IsInfo())
+}
+
+func TestRecorder_With_EvaluatesOnce(t *testing.T) {
+	rec := log.NewRecorder()
+	var calls int
+	lg := log.Tee(rec, log.NewRecorder()).With(log.StringFn("calls", func(add log.AddStringFn) error {
+		calls++
+		add("calls", strconv.Itoa(calls))
+		return nil
+	}))
+	lg.Info("first", log.Int("i", 1))
+	lg.Info("second")
+	assert.Exactly(t, 1, calls, "With must evaluate the fields once for all loggers")
+
+	snap := rec.Snapshot()
+	assert.Exactly(t, 2, len(snap))
+	assert.Exactly(t, ` calls: "1" i: 1`, snap[0].Fields)
+	assert.Exactly(t, ` calls: "1"`, snap[1].Fields)
+}
+
+func TestTee_EvaluatesOnce(t *testing.T) {
+	rec1, rec2 := log.NewRecorder(), log.NewRecorder()
+	var calls int
+	fn := log.StringFn("calls", func(add log.AddStringFn) error {
+		calls++
+		add("calls", strconv.Itoa(calls))
+		return nil
+	})
+	lg := log.Tee(rec1, rec2)
+	lg.Info("info", fn)
+	lg.Debug("debug", fn)
+	assert.Exactly(t, 2, calls, "Each call must evaluate the fields once for all loggers")
+
+	for _, rec := range []*log.Recorder{rec1, rec2} {
+		snap := rec.Snapshot()
+		assert.Exactly(t, 2, len(snap))
+		assert.Exactly(t, ` calls: "1"`, snap[0].Fields)
+		assert.Exactly(t, ` calls: "2"`, snap[1].Fields)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+// tee forwards all entries to multiple loggers.
+type tee []Logger
+
+// Tee creates a Logger which forwards each entry to all loggers whose level
+// is enabled. For example a Recorder can record the debug history alongside a
+// production logger with Info level:
+//
+//	lg := log.Tee(production, recorder)
+func Tee(loggers ...Logger) Logger {
+	return tee(loggers)
+}
+
+// With returns a new Logger that has this logger's context plus the given
+// Fields. The fields get captured once and not per logger, see Capture.
+func (t tee) With(fields ...Field) Logger {
+	captured, _ := Capture(fields...)
+	t2 := make(tee, len(t))
+	for i, l := range t {
+		t2[i] = l.With(captured...)
+	}
+	return t2
+}
+
+// capture evaluates the fields once if more than one logger is enabled, so
+// StringFn and Marshaler fields do not run per logger.
+func (t tee) capture(enabled func(Logger) bool, fields Fields) Fields {
+	if len(fields) == 0 {
+		return fields
+	}
+	var n int
+	for _, l := range t {
+		if enabled(l) {
+			n++
+		}
+	}
+	if n < 2 {
+		return fields
+	}
+	captured, _ := Capture(fields...)
+	return captured
+}
+
+// Debug forwards the entry to all loggers with enabled Debug level. The fields
+// get evaluated once, see Capture.
+func (t tee) Debug(msg string, fields ...Field) {
+	fields = t.capture(Logger.IsDebug, fields)
+	for _, l := range t {
+		if l.IsDebug() {
+			l.Debug(msg, fields...)
+		}
+	}
+}
+
+// Info forwards the entry to all loggers with enabled Info level. The fields
+// get evaluated once, see Capture.
+func (t tee) Info(msg string, fields ...Field) {
+	fields = t.capture(Logger.IsInfo, fields)
+	for _, l := range t {
+		if l.IsInfo() {
+			l.Info(msg, fields...)
+		}
+	}
+}
+
+// IsDebug returns true if at least one logger has Debug level enabled.
+func (t tee) IsDebug() bool {
+	for _, l := range t {
+		if l.IsDebug() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInfo returns true if at least one logger has Info level enabled.
+func (t tee) IsInfo() bool {
+	for _, l := range t {
+		if l.IsInfo() {
+			return true
+		}
+	}
+	return false
+}
@@ -16,7 +16,6 @@ package zapw
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
@@ -96,9 +95,7 @@ func (se *zapFieldWrap) AddInt64(k string, v int64) {
 }
 
 func (se *zapFieldWrap) AddUint64(k string, v uint64) {
-	// zap.Uint64 cannot be used as it has IMHO an architecture bug because the
-	// uint64 gets casted into an int64 and you loose data.
-	se.zf = append(se.zf, zap.String(k, strconv.FormatUint(v, 10)))
+	se.zf = append(se.zf, zap.Uint64(k, v))
 }
 
 func (se *zapFieldWrap) AddMarshaler(k string, v log.Marshaler) error {
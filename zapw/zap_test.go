@@ -83,7 +83,7 @@ func TestNewJSON_Debug(t *testing.T) {
 	assert.Contains(t, out, `"error":"I'm an info error"`)
 	assert.Contains(t, out, `"kInfo":"v1"`)
 	assert.Contains(t, out, `"infoDur":3600000000`)
-	assert.Contains(t, out, `"myDebugUint":"4294967295"`)
+	assert.Contains(t, out, `"myDebugUint":4294967295`)
 }
 
 func TestNewJSON_Info(t *testing.T) {
@@ -92,8 +92,8 @@ func TestNewJSON_Info(t *testing.T) {
 	assert.Contains(t, out, `"error":"I'm an info error"`)
 	assert.Contains(t, out, `"kInfo":"v1","infoDur":3600000000`)
 	assert.Contains(t, out, `"e":2.7182`)
-	assert.Contains(t, out, `"myInfoUint":"4294967295"`)
-	assert.NotContains(t, out, `"myDebugUint":"4294967295"`)
+	assert.Contains(t, out, `"myInfoUint":4294967295`)
+	assert.NotContains(t, out, `"myDebugUint":4294967295`)
 }
 
 type marshalMock struct {